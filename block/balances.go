@@ -0,0 +1,237 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bc/utils"
+)
+
+// ****************Address Index Related ****************//
+
+// The address index holds the confirmed balance of every address, the
+// number of transactions it sent and the transactions that changed its
+// balance. It is updated as blocks are connected and unwound as they are
+// disconnected, so balance, nonce and history lookups never scan the chain.
+// Like the transaction index it lives in memory and is rebuilt from the
+// stored blocks on start or by Reindex.
+
+type addressIndex struct {
+	balances map[string]utils.Amount
+	nonces   map[string]uint64
+	history  map[string][]historyEntry
+}
+
+// historyEntry is a confirmed transaction that changed the balance of an
+// address by amount, leaving it at balance.
+type historyEntry struct {
+	height       int
+	index        int
+	amount       utils.Amount
+	counterparty string
+	balance      utils.Amount
+}
+
+// balanceChange is the net effect of a transaction on one address.
+type balanceChange struct {
+	address      string
+	amount       utils.Amount
+	counterparty string
+}
+
+func newAddressIndex() *addressIndex {
+	return &addressIndex{
+		balances: make(map[string]utils.Amount),
+		nonces:   make(map[string]uint64),
+		history:  make(map[string][]historyEntry),
+	}
+}
+
+// balanceChanges lists the addresses t credits or debits, in order of first
+// appearance. spent holds the outputs t consumes on a UTXO ledger, in input
+// order. Blocks, including the ones loaded from the store, and pool
+// transactions passed validation, so the sums cannot overflow.
+func balanceChanges(t *Transaction, spent []spentOutput) []balanceChange {
+	var changes []balanceChange
+	add := func(address string, amount utils.Amount) {
+		for i := range changes {
+			if changes[i].address == address {
+				changes[i].amount += amount
+				return
+			}
+		}
+		changes = append(changes, balanceChange{address: address, amount: amount})
+	}
+	if !t.isUTXO() {
+		if t.senderBlockchainAddress != MINING_SENDER {
+			add(t.senderBlockchainAddress, -(t.value + t.fee))
+		}
+		add(t.receiverBlockchainAddress, t.value)
+		for i := range changes {
+			if changes[i].address == t.receiverBlockchainAddress {
+				changes[i].counterparty = t.senderBlockchainAddress
+			} else {
+				changes[i].counterparty = t.receiverBlockchainAddress
+			}
+		}
+		return changes
+	}
+	for _, s := range spent {
+		add(s.entry.output.Address, -s.entry.output.Value)
+	}
+	for _, out := range t.outputs {
+		add(out.Address, out.Value)
+	}
+	// a payer faces the first output it does not own, a payee the first
+	// input it does not own
+	for i := range changes {
+		c := &changes[i]
+		c.counterparty = c.address
+		if c.amount < 0 {
+			for _, out := range t.outputs {
+				if out.Address != c.address {
+					c.counterparty = out.Address
+					break
+				}
+			}
+		} else {
+			for _, s := range spent {
+				if s.entry.output.Address != c.address {
+					c.counterparty = s.entry.output.Address
+					break
+				}
+			}
+		}
+	}
+	return changes
+}
+
+// connect applies b, appended at height. spent lists the outputs b consumed
+// on a UTXO ledger.
+func (ai *addressIndex) connect(b *Block, height int, spent []spentOutput) {
+	for i, t := range b.transactions {
+		n := len(t.inputs)
+		if n > len(spent) {
+			n = len(spent)
+		}
+		if !t.isUTXO() && t.senderBlockchainAddress != MINING_SENDER {
+			ai.nonces[t.senderBlockchainAddress]++
+		}
+		for _, c := range balanceChanges(t, spent[:n]) {
+			ai.balances[c.address] += c.amount
+			ai.history[c.address] = append(ai.history[c.address], historyEntry{
+				height:       height,
+				index:        i,
+				amount:       c.amount,
+				counterparty: c.counterparty,
+				balance:      ai.balances[c.address],
+			})
+		}
+		spent = spent[n:]
+	}
+}
+
+// disconnect reverts connect for the same block and spent outputs.
+func (ai *addressIndex) disconnect(b *Block, spent []spentOutput) {
+	changes := make([][]balanceChange, len(b.transactions))
+	for i, t := range b.transactions {
+		n := len(t.inputs)
+		if n > len(spent) {
+			n = len(spent)
+		}
+		changes[i] = balanceChanges(t, spent[:n])
+		spent = spent[n:]
+	}
+	for i := len(b.transactions) - 1; i >= 0; i-- {
+		t := b.transactions[i]
+		for _, c := range changes[i] {
+			ai.balances[c.address] -= c.amount
+			ai.history[c.address] = ai.history[c.address][:len(ai.history[c.address])-1]
+			ai.forget(c.address)
+		}
+		if !t.isUTXO() && t.senderBlockchainAddress != MINING_SENDER {
+			ai.nonces[t.senderBlockchainAddress]--
+			ai.forget(t.senderBlockchainAddress)
+		}
+	}
+}
+
+// forget drops blockchainAddress once nothing on the chain refers to it.
+func (ai *addressIndex) forget(blockchainAddress string) {
+	if ai.balances[blockchainAddress] == 0 && ai.nonces[blockchainAddress] == 0 && len(ai.history[blockchainAddress]) == 0 {
+		delete(ai.balances, blockchainAddress)
+		delete(ai.nonces, blockchainAddress)
+		delete(ai.history, blockchainAddress)
+	}
+}
+
+// connectBlock updates every index and the ledger state for b appended at
+// height. The caller must hold bc.mux.
+func (bc *BlockChain) connectBlock(b *Block, height int) {
+	bc.indexBlock(b, height)
+	bc.connectUTXOBlock(b, height)
+	var spent []spentOutput
+	if bc.utxos != nil {
+		spent = bc.spentOutputs[height]
+	}
+	bc.addresses.connect(b, height, spent)
+}
+
+// disconnectBlocks reverts connectBlock for the blocks from height up. The
+// caller must hold bc.mux.
+func (bc *BlockChain) disconnectBlocks(height int) {
+	for h := len(bc.chain) - 1; h >= height; h-- {
+		var spent []spentOutput
+		if bc.utxos != nil {
+			spent = bc.spentOutputs[h]
+		}
+		bc.addresses.disconnect(bc.chain[h], spent)
+	}
+	bc.unindexBlocks(height)
+	bc.disconnectUTXOBlocks(height)
+}
+
+// resetIndexes drops every index and the ledger state and rebuilds them for
+// chain, which becomes the chain of bc. The caller must hold bc.mux.
+func (bc *BlockChain) resetIndexes(chain []*Block) {
+	bc.chain = chain
+	bc.transactionIndex = make(map[[32]byte]int)
+	bc.blockIndex = make(map[[32]byte]int)
+	bc.addresses = newAddressIndex()
+	bc.spentOutputs = nil
+	if bc.utxos != nil {
+		bc.utxos = newUTXOSet(bc.params)
+	}
+	for height, b := range bc.chain {
+		bc.connectBlock(b, height)
+	}
+}
+
+type ReindexResponse struct {
+	Blocks    int `json:"blocks"`
+	Addresses int `json:"addresses"`
+}
+
+// Reindex rebuilds the block and transaction indexes, the address index and, on a UTXO
+// ledger, the UTXO set from the blocks in the store, which replace the chain
+// held in memory. The pool is then checked against the rebuilt state.
+func (bc *BlockChain) Reindex() (*ReindexResponse, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	chain, err := bc.store.Blocks()
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("store holds no blocks")
+	}
+	if err := ValidChain(chain, bc.params); err != nil {
+		return nil, fmt.Errorf("stored chain: %w", err)
+	}
+	bc.miner.abort()
+	bc.resetIndexes(chain)
+	bc.revalidatePool()
+	log.Printf("action=reindex, blocks=%d, addresses=%d", len(bc.chain), len(bc.addresses.balances))
+	return &ReindexResponse{Blocks: len(bc.chain), Addresses: len(bc.addresses.balances)}, nil
+}
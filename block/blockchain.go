@@ -1,11 +1,15 @@
 package block
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,10 +19,17 @@ import (
 
 // **************structures*****************//
 
-type Block struct {
+type BlockHeader struct {
+	chainID      uint32
 	timeStamp    int64
 	nonce        int
+	bits         uint32
 	previousHash [32]byte
+	merkleRoot   [32]byte
+}
+
+type Block struct {
+	header       BlockHeader
 	transactions []*Transaction
 }
 type BlockChain struct {
@@ -29,70 +40,194 @@ type BlockChain struct {
 	mux               sync.Mutex
 	neighbors         []string
 	muxNeighbors      sync.Mutex
+	store             Store
+	seenTransactions  map[[32]byte]int64
+	transactionIndex  map[[32]byte]int
+	blockIndex        map[[32]byte]int
+	reorgs            []*ReorgEvent
+	orphans           map[[32]byte]*orphanBlock
+	addresses         *addressIndex
+	muxSeen           sync.Mutex
+	muxResolve        sync.Mutex
+	resolving         bool
+	resolvePending    bool
+	miner             *miner
+	ctx               context.Context
+	shutdown          context.CancelFunc
+	params            *ChainParams
+	utxos             *utxoSet
+	spentOutputs      [][]spentOutput
 }
 
 type Transaction struct {
+	chainID                   uint32
 	senderBlockchainAddress   string
 	receiverBlockchainAddress string
-	value                     float32
+	value                     utils.Amount
+	fee                       utils.Amount
+	nonce                     uint64
+	senderPublicKey           *ecdsa.PublicKey
+	signature                 *utils.Signature
+	inputs                    []*TxInput
+	outputs                   []*TxOutput
 }
 
 type TransactionRequest struct {
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	ChainID                    *uint32       `json:"chain_id"`
+	SenderPublicKey            *string       `json:"sender_public_key"`
+	SenderBlockchainAddress    *string       `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string       `json:"recipient_blockchain_address"`
+	Value                      *utils.Amount `json:"value"`
+	Fee                        *utils.Amount `json:"fee,omitempty"`
+	Nonce                      *uint64       `json:"nonce"`
+	Signature                  *string       `json:"signature"`
+	Inputs                     []*TxInput    `json:"inputs,omitempty"`
+	Outputs                    []*TxOutput   `json:"outputs,omitempty"`
 }
 
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount utils.Amount `json:"amount"`
+}
+
+type NonceResponse struct {
+	Nonce uint64 `json:"nonce"`
 }
 
 // ************gen****************//
 const (
-	MINING_DIFFICULTY                 = 3
 	MINING_SENDER                     = "I AM A MINER"
-	MINING_REWARD                     = 1.0
-	MINING_TIMER_SEC                  = 30
-	BLOCKCHAIN_PORT_RANGE_START       = 5000
-	BLOCKCHAIN_PORT_RANGE_END         = 5003
 	NEIGHBOR_IP_RANGE_START           = 0
 	NEIGHBOR_IP_RANGE_END             = 1
 	BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC = 20
+	BLOCKCHAIN_RESOLVE_CONFLICTS_SEC  = 30
+	NEIGHBOR_REQUEST_TIMEOUT_SEC      = 5
+	SEEN_TRANSACTION_TTL_SEC          = 600
 )
 
 // ******************Block Related****************//
+
+// Hash identifies the block. Only the header is hashed; the transactions are
+// committed to through its merkle root.
 func (b *Block) Hash() [32]byte {
-	m, _ := json.Marshal(b)
-	// fmt.Println(string(m))
-	return sha256.Sum256([]byte(m))
+	return b.header.Hash()
+}
+
+// Hash is the SHA-256 of the canonical encoding of h.
+func (h *BlockHeader) Hash() [32]byte {
+	return sha256.Sum256(h.Encode())
+}
+
+func (h *BlockHeader) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ChainID      uint32 `json:"chain_id"`
+		TimeStamp    int64  `json:"timestamp"`
+		Nonce        int    `json:"nonce"`
+		Bits         string `json:"bits"`
+		PreviousHash string `json:"previous_hash"`
+		MerkleRoot   string `json:"merkle_root"`
+	}{
+		ChainID:      h.chainID,
+		TimeStamp:    h.timeStamp,
+		Nonce:        h.nonce,
+		Bits:         fmt.Sprintf("%08x", h.bits),
+		PreviousHash: fmt.Sprintf("%x", h.previousHash),
+		MerkleRoot:   fmt.Sprintf("%x", h.merkleRoot),
+	})
+}
+
+func (h *BlockHeader) UnmarshalJSON(data []byte) error {
+	var bits, previousHash, merkleRoot string
+	v := &struct {
+		ChainID      *uint32 `json:"chain_id"`
+		TimeStamp    *int64  `json:"timestamp"`
+		Nonce        *int    `json:"nonce"`
+		Bits         *string `json:"bits"`
+		PreviousHash *string `json:"previous_hash"`
+		MerkleRoot   *string `json:"merkle_root"`
+	}{
+		ChainID:      &h.chainID,
+		TimeStamp:    &h.timeStamp,
+		Nonce:        &h.nonce,
+		Bits:         &bits,
+		PreviousHash: &previousHash,
+		MerkleRoot:   &merkleRoot,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(bits, 16, 32)
+	if err != nil {
+		return fmt.Errorf("invalid bits %q", bits)
+	}
+	h.bits = uint32(n)
+	if h.previousHash, err = decodeHash("previous_hash", previousHash); err != nil {
+		return err
+	}
+	if h.merkleRoot, err = decodeHash("merkle_root", merkleRoot); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeHash reads a 32 byte hash written in hex, naming field on failure.
+func decodeHash(field, s string) ([32]byte, error) {
+	var hash [32]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(hash) {
+		return hash, fmt.Errorf("invalid %s %q", field, s)
+	}
+	copy(hash[:], b)
+	return hash, nil
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		TimeStamp    int64          `json:"timestamp"`
-		Nonce        int            `json:"nonce"`
-		PreviousHash string         `json:"previous_hash"`
+		Header       *BlockHeader   `json:"header"`
 		Transactions []*Transaction `json:"transactions"`
-	}{TimeStamp: b.timeStamp,
-		Nonce:        b.nonce,
-		PreviousHash: fmt.Sprintf("%x", b.previousHash),
+	}{
+		Header:       &b.header,
 		Transactions: b.transactions,
 	})
 }
 
+func (b *Block) UnmarshalJSON(data []byte) error {
+	v := &struct {
+		Header       *BlockHeader    `json:"header"`
+		Transactions *[]*Transaction `json:"transactions"`
+	}{
+		Transactions: &b.transactions,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Header == nil {
+		return fmt.Errorf("missing header")
+	}
+	b.header = *v.Header
+	for i, t := range b.transactions {
+		if t == nil {
+			return fmt.Errorf("null transaction %d", i)
+		}
+	}
+	return nil
+}
+
+// NewBlock creates a block on top of previousHash, stamped with the current
+// time and committing to transactions through their merkle root. Its chain
+// id and target bits are left for the caller to set.
 func NewBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
 	b := new(Block)
-	b.timeStamp = time.Now().UnixNano()
-	b.previousHash = previousHash
-	b.nonce = nonce
+	b.header.timeStamp = time.Now().UnixNano()
+	b.header.previousHash = previousHash
+	b.header.nonce = nonce
+	b.header.merkleRoot = merkleRootOf(transactions)
 	b.transactions = transactions
 	return b
 }
 
 func (bc *BlockChain) Run() {
 	bc.StartSyncNeighbors()
+	bc.StartResolveConflicts()
 }
 
 func (bc *BlockChain) SetNeighbors() {
@@ -102,8 +237,8 @@ func (bc *BlockChain) SetNeighbors() {
 		bc.port,
 		NEIGHBOR_IP_RANGE_START,
 		NEIGHBOR_IP_RANGE_END,
-		BLOCKCHAIN_PORT_RANGE_START,
-		BLOCKCHAIN_PORT_RANGE_END,
+		bc.params.PortRangeStart,
+		bc.params.PortRangeEnd,
 	)
 }
 func (bc *BlockChain) SyncNeighbors() {
@@ -118,9 +253,12 @@ func (bc *BlockChain) StartSyncNeighbors() {
 }
 
 func (b *Block) Print() {
-	fmt.Printf("timestamp    %d\n", b.timeStamp)
-	fmt.Printf("nonce    %d\n", b.nonce)
-	fmt.Printf("previousHash    %x\n", b.previousHash)
+	fmt.Printf("chainID    %d\n", b.header.chainID)
+	fmt.Printf("timestamp    %d\n", b.header.timeStamp)
+	fmt.Printf("nonce    %d\n", b.header.nonce)
+	fmt.Printf("bits    %08x\n", b.header.bits)
+	fmt.Printf("previousHash    %x\n", b.header.previousHash)
+	fmt.Printf("merkleRoot    %x\n", b.header.merkleRoot)
 	for _, t := range b.transactions {
 		t.Print()
 	}
@@ -129,100 +267,254 @@ func (b *Block) Print() {
 
 // ***********Block Chain Related *******************//
 
-func NewBlockChain(blockchainAddress string, port uint16) *BlockChain {
+// NewBlockChain resumes the mainnet chain kept in store, creating the
+// genesis block when the store is empty.
+func NewBlockChain(blockchainAddress string, port uint16, store Store) (*BlockChain, error) {
+	return NewBlockChainWithParams(blockchainAddress, port, store, MainnetParams())
+}
+
+// NewBlockChainWithParams is NewBlockChain for the network of params. A
+// store must always be opened with the params it was created with; a store
+// whose genesis block differs is refused.
+func NewBlockChainWithParams(blockchainAddress string, port uint16, store Store, params *ChainParams) (*BlockChain, error) {
+	if err := params.Validate(); err != nil {
+		return nil, fmt.Errorf("chain params %s: %w", params.Name, err)
+	}
+	if err := params.CheckAddress(blockchainAddress); err != nil {
+		return nil, fmt.Errorf("miner address: %w", err)
+	}
 	bc := new(BlockChain)
-	b := &Block{}
 	bc.blockchainAddress = blockchainAddress
 	bc.port = port
-	bc.CreateBlock(0, b.Hash())
-	return bc
+	bc.store = store
+	bc.params = params
+	if params.Ledger == LEDGER_UTXO {
+		bc.utxos = newUTXOSet(params)
+	}
+	bc.miner = new(miner)
+	bc.ctx, bc.shutdown = context.WithCancel(context.Background())
+
+	chain, err := store.Blocks()
+	if err != nil {
+		return nil, err
+	}
+	transactionPool, err := store.TransactionPool()
+	if err != nil {
+		return nil, err
+	}
+	genesis := params.Genesis()
+	if len(chain) > 0 && chain[0].Hash() != genesis.Hash() {
+		return nil, fmt.Errorf("store holds a chain of another network: genesis %x, want %x for %s", chain[0].Hash(), genesis.Hash(), params.Name)
+	}
+	// the indexes sum amounts unchecked, which only validated blocks allow
+	if len(chain) > 0 {
+		if err := ValidChain(chain, params); err != nil {
+			return nil, fmt.Errorf("stored chain: %w", err)
+		}
+	}
+	bc.transactionPool = transactionPool
+	bc.resetIndexes(chain)
+	if len(bc.chain) == 0 {
+		bc.appendBlock(genesis)
+	} else {
+		// the pool may have been saved before the last blocks were stored
+		bc.revalidatePool()
+	}
+	return bc, nil
+}
+
+// Close stops mining and releases the store backing the chain.
+func (bc *BlockChain) Close() error {
+	bc.shutdown()
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.store.Close()
 }
+
+// MarshalJSON encodes a copy of the chain taken under bc.mux; blocks never
+// change once appended, so they are encoded without it.
 func (bc *BlockChain) MarshalJSON() ([]byte, error) {
+	bc.mux.Lock()
+	chain := make([]*Block, len(bc.chain))
+	copy(chain, bc.chain)
+	bc.mux.Unlock()
 	return json.Marshal(struct {
 		Blocks []*Block `json:"chains"`
 	}{
 
-		Blocks: bc.chain,
+		Blocks: chain,
 	})
 }
 
-func (bc *BlockChain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.transactionPool)
+// appendBlock puts b on top of the chain and drops the transactions it
+// includes from the pool. A running proof of work search is aborted.
+func (bc *BlockChain) appendBlock(b *Block) {
+	bc.miner.abort()
 	bc.chain = append(bc.chain, b)
-	bc.transactionPool = []*Transaction{}
-	return b
+	bc.connectBlock(b, len(bc.chain)-1)
+	if err := bc.store.AppendBlock(b); err != nil {
+		log.Printf("ERROR: Store block %v", err)
+	}
+	bc.dropIncludedTransactions([]*Block{b})
+	bc.revalidatePool()
 }
-func (bc *BlockChain) CreateTransaction(sender, receiver string, value float32, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) bool {
-	isTransacted := bc.AddTransaction(sender, receiver, value, senderPublicKey, signature)
-	// TODO
-	// Sync with other servers
 
-	return isTransacted
+// dropIncludedTransactions removes every pool transaction found in blocks.
+func (bc *BlockChain) dropIncludedTransactions(blocks []*Block) {
+	included := make(map[[32]byte]bool)
+	for _, b := range blocks {
+		for _, t := range b.transactions {
+			included[t.ID()] = true
+		}
+	}
+	transactionPool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if !included[t.ID()] {
+			transactionPool = append(transactionPool, t)
+		}
+	}
+	bc.transactionPool = transactionPool
+	bc.saveTransactionPool()
 }
 
-func (bc *BlockChain) AddTransaction(sender, receiver string, value float32, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) bool {
-	t := NewTransaction(sender, receiver, value)
-	if sender == MINING_SENDER {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+func (bc *BlockChain) saveTransactionPool() {
+	if err := bc.store.SaveTransactionPool(bc.transactionPool); err != nil {
+		log.Printf("ERROR: Store transaction pool %v", err)
 	}
-	if bc.VerifyTransactionSignature(senderPublicKey, signature, t) {
-		/* //have commented this for now. You can uncomment when live
-		if bc.CalculateTotal(sender) < value {
-			log.Println("Error: Insufficient Balance")
-			return false
-		} */
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+}
 
-	} else {
-		log.Println("ERROR: Verify Transaction")
+// CreateTransaction adds a transaction posted by a client or relayed by a
+// neighbor, relays it to the neighbors when it was not seen before and
+// returns its id. chainID must be the network id of the chain.
+func (bc *BlockChain) CreateTransaction(chainID uint32, sender, receiver string, value, fee utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) ([32]byte, error) {
+	t := NewTransaction(chainID, sender, receiver, value, fee, nonce)
+	t.senderPublicKey = senderPublicKey
+	t.signature = signature
+	if err := bc.AddTransaction(chainID, sender, receiver, value, fee, nonce, senderPublicKey, signature); err != nil {
+		return t.ID(), err
+	}
+	bc.broadcastTransaction(t)
+	return t.ID(), nil
+}
+
+func (bc *BlockChain) AddTransaction(chainID uint32, sender, receiver string, value, fee utils.Amount, nonce uint64, senderPublicKey *ecdsa.PublicKey, signature *utils.Signature) error {
+	t := NewTransaction(chainID, sender, receiver, value, fee, nonce)
+	t.senderPublicKey = senderPublicKey
+	t.signature = signature
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	err := bc.addTransaction(t)
+	if err != nil {
+		log.Printf("ERROR: Add Transaction %v", err)
 	}
-	return false
+	return err
+}
 
+// addTransaction puts t in the pool. The caller must hold bc.mux.
+func (bc *BlockChain) addTransaction(t *Transaction) error {
+	if t.senderBlockchainAddress == MINING_SENDER {
+		return ErrCoinbaseTransaction
+	}
+	if err := bc.params.checkNetwork(t); err != nil {
+		return err
+	}
+	if bc.utxos != nil {
+		return bc.addUTXOTransaction(t)
+	}
+	if t.isUTXO() {
+		return ErrLedgerMismatch
+	}
+	if t.value <= 0 {
+		return ErrInvalidValue
+	}
+	if t.fee < 0 {
+		return ErrInvalidFee
+	}
+	if !bc.VerifyTransactionSignature(t.senderPublicKey, t.signature, t) || !ownsAddress(t.senderPublicKey, t.senderBlockchainAddress, bc.params.AddressVersion) {
+		return ErrInvalidSignature
+	}
+	id := t.ID()
+	if bc.seen(id) {
+		return ErrDuplicateTransaction
+	}
+	nextNonce := bc.nextNonce(t.senderBlockchainAddress)
+	if t.nonce < nextNonce {
+		return fmt.Errorf("%w: nonce %d already used, next is %d", ErrInvalidNonce, t.nonce, nextNonce)
+	}
+	if t.nonce > nextNonce {
+		return fmt.Errorf("%w: nonce %d out of order, next is %d", ErrInvalidNonce, t.nonce, nextNonce)
+	}
+	spendable, err := bc.spendableBalance(t.senderBlockchainAddress)
+	if err != nil {
+		return err
+	}
+	cost, err := t.cost()
+	if err != nil {
+		return err
+	}
+	if spendable < cost {
+		return fmt.Errorf("%w: %s spendable, %s requested", ErrInsufficientBalance, spendable, cost)
+	}
+	bc.markSeen(id)
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.saveTransactionPool()
+	return nil
 }
 
 func (bc *BlockChain) VerifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, signature *utils.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
+	return verifyTransactionSignature(senderPublicKey, signature, t)
+}
+
+func verifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, signature *utils.Signature, t *Transaction) bool {
+	if senderPublicKey == nil || signature == nil {
+		return false
+	}
+	h := t.SigningHash()
 	return ecdsa.Verify(senderPublicKey, h[:], signature.R, signature.S)
 }
 
+// ownsAddress reports whether publicKey derives address on the network whose
+// addresses start with version.
+func ownsAddress(publicKey *ecdsa.PublicKey, address string, version byte) bool {
+	return publicKey != nil && utils.BlockchainAddress(publicKey, version) == address
+}
+
 func (bc *BlockChain) CopyTransactionPool() []*Transaction {
 	transactions := make([]*Transaction, 0)
 	for _, t := range bc.transactionPool {
-		transactions = append(transactions, NewTransaction(t.senderBlockchainAddress, t.receiverBlockchainAddress, t.value))
+		c := NewTransaction(t.chainID, t.senderBlockchainAddress, t.receiverBlockchainAddress, t.value, t.fee, t.nonce)
+		c.senderPublicKey = t.senderPublicKey
+		c.signature = t.signature
+		c.inputs = t.inputs
+		c.outputs = t.outputs
+		transactions = append(transactions, c)
 
 	}
 	return transactions
 }
 
+// TransactionPool returns a copy of the pool.
 func (bc *BlockChain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	transactions := make([]*Transaction, len(bc.transactionPool))
+	copy(transactions, bc.transactionPool)
+	return transactions
 }
 
-func (bc *BlockChain) ValidProof(nonce int, previousHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{
-		timeStamp:    0,
-		nonce:        nonce,
-		previousHash: previousHash,
-		transactions: transactions,
-	}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHashStr[:difficulty] == zeros
-
+func (bc *BlockChain) ValidProof(header *BlockHeader) bool {
+	return validProof(header, bc.params)
 }
 
-func (bc *BlockChain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	previousHash := bc.LastBlock().Hash()
-	nonce := 0
-	for !bc.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
+// validProof reports whether the hash of header meets the target of its bits
+// under the proof of work limit of p.
+func validProof(header *BlockHeader, p *ChainParams) bool {
+	target, ok := targetBytes(header.bits, p.powLimit())
+	if !ok {
+		return false
 	}
-	return nonce
-
+	hash := header.Hash()
+	return meetsTarget(&hash, &target)
 }
 
 func (bc *BlockChain) LastBlock() *Block {
@@ -240,24 +532,20 @@ func (bc *BlockChain) Print() {
 
 }
 
-func (bc *BlockChain) CalculateTotal(blockchainAddress string) float32 {
-	var totalAmount float32 = 0.0
-	for _, b := range bc.chain {
-		for _, t := range b.transactions {
-			if blockchainAddress == t.receiverBlockchainAddress {
-				totalAmount += t.value
-			}
-			if blockchainAddress == t.senderBlockchainAddress {
-				totalAmount -= t.value
-			}
-		}
-	}
-	return totalAmount
+// CalculateTotal returns the confirmed balance of blockchainAddress.
+func (bc *BlockChain) CalculateTotal(blockchainAddress string) utils.Amount {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.calculateTotal(blockchainAddress)
+}
+
+func (bc *BlockChain) calculateTotal(blockchainAddress string) utils.Amount {
+	return bc.addresses.balances[blockchainAddress]
 }
 
 func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Amount float32 `json:"amount"`
+		Amount utils.Amount `json:"amount"`
 	}{
 		Amount: ar.Amount,
 	})
@@ -266,55 +554,251 @@ func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 
 // ************transactions related******************//
 
-func NewTransaction(sender, receiver string, value float32) *Transaction {
-	return &Transaction{senderBlockchainAddress: sender, receiverBlockchainAddress: receiver, value: value}
+// NewTransaction creates an unsigned transaction on the chain chainID paying
+// fee to the miner on top of value. nonce counts the transactions sent by
+// sender before this one; for a coinbase it is the height of its block and
+// for a genesis allocation GENESIS_ALLOCATION_NONCE plus its index.
+func NewTransaction(chainID uint32, sender, receiver string, value, fee utils.Amount, nonce uint64) *Transaction {
+	return &Transaction{chainID: chainID, senderBlockchainAddress: sender, receiverBlockchainAddress: receiver, value: value, fee: fee, nonce: nonce}
+}
+
+// cost is what the sender of t pays, value plus fee.
+func (t *Transaction) cost() (utils.Amount, error) {
+	return t.value.Add(t.fee)
 }
 
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 30))
+	fmt.Printf("Chain_ID:       %d\n", t.chainID)
 	fmt.Printf("Sender_Blockchain_Address: %s\n", t.senderBlockchainAddress)
 	fmt.Printf("Receiver_Blockchain_Address: %s\n", t.receiverBlockchainAddress)
-	fmt.Printf("Value:          %1f\n", t.value)
+	fmt.Printf("Value:          %s\n", t.value)
+	fmt.Printf("Fee:            %s\n", t.fee)
+	fmt.Printf("Nonce:          %d\n", t.nonce)
+	for _, in := range t.inputs {
+		fmt.Printf("Input:          %s\n", in.PreviousOutput)
+	}
+	for _, out := range t.outputs {
+		fmt.Printf("Output:         %s %s\n", out.Address, out.Value)
+	}
+}
+
+// SigningHash is the digest the sender signs, see EncodeTransactionPayload
+// and EncodeUTXOTransactionPayload.
+func (t *Transaction) SigningHash() [32]byte {
+	if t.isUTXO() {
+		return sha256.Sum256(EncodeUTXOTransactionPayload(t.chainID, t.inputs, t.outputs, t.fee))
+	}
+	return TransactionSigningHash(t.chainID, t.senderBlockchainAddress, t.receiverBlockchainAddress, t.value, t.fee, t.nonce)
+}
+
+// ID is the hash of the signed payload. The nonce makes it unique per
+// sender, and leaving the signature out means re-signing the same payload
+// cannot yield a second id.
+func (t *Transaction) ID() [32]byte {
+	return t.SigningHash()
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	var publicKey, signature string
+	if t.senderPublicKey != nil {
+		publicKey = fmt.Sprintf("%064x%064x", t.senderPublicKey.X, t.senderPublicKey.Y)
+	}
+	if t.signature != nil {
+		signature = t.signature.String()
+	}
 	return json.Marshal(struct {
-		SenderBlockchainAddress   string  `json:"sender_blockchain_address"`
-		ReceiverBlockchainAddress string  `json:"receiver_blockchain_address"`
-		Value                     float32 `json:"value"`
+		ID                        string       `json:"id"`
+		ChainID                   uint32       `json:"chain_id"`
+		SenderBlockchainAddress   string       `json:"sender_blockchain_address"`
+		ReceiverBlockchainAddress string       `json:"receiver_blockchain_address"`
+		Value                     utils.Amount `json:"value"`
+		Fee                       utils.Amount `json:"fee"`
+		Nonce                     uint64       `json:"nonce"`
+		SenderPublicKey           string       `json:"sender_public_key,omitempty"`
+		Signature                 string       `json:"signature,omitempty"`
+		Inputs                    []*TxInput   `json:"inputs,omitempty"`
+		Outputs                   []*TxOutput  `json:"outputs,omitempty"`
 	}{
+		ID:                        fmt.Sprintf("%x", t.ID()),
+		ChainID:                   t.chainID,
 		SenderBlockchainAddress:   t.senderBlockchainAddress,
 		ReceiverBlockchainAddress: t.receiverBlockchainAddress,
 		Value:                     t.value,
+		Fee:                       t.fee,
+		Nonce:                     t.nonce,
+		SenderPublicKey:           publicKey,
+		Signature:                 signature,
+		Inputs:                    t.inputs,
+		Outputs:                   t.outputs,
 	})
 }
 
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var publicKey, signature string
+	v := &struct {
+		ChainID                   *uint32       `json:"chain_id"`
+		SenderBlockchainAddress   *string       `json:"sender_blockchain_address"`
+		ReceiverBlockchainAddress *string       `json:"receiver_blockchain_address"`
+		Value                     *utils.Amount `json:"value"`
+		Fee                       *utils.Amount `json:"fee"`
+		Nonce                     *uint64       `json:"nonce"`
+		SenderPublicKey           *string       `json:"sender_public_key"`
+		Signature                 *string       `json:"signature"`
+		Inputs                    *[]*TxInput   `json:"inputs"`
+		Outputs                   *[]*TxOutput  `json:"outputs"`
+	}{
+		ChainID:                   &t.chainID,
+		SenderBlockchainAddress:   &t.senderBlockchainAddress,
+		ReceiverBlockchainAddress: &t.receiverBlockchainAddress,
+		Value:                     &t.value,
+		Fee:                       &t.fee,
+		Nonce:                     &t.nonce,
+		SenderPublicKey:           &publicKey,
+		Signature:                 &signature,
+		Inputs:                    &t.inputs,
+		Outputs:                   &t.outputs,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	for i, in := range t.inputs {
+		if in == nil {
+			return fmt.Errorf("null input %d", i)
+		}
+	}
+	for i, out := range t.outputs {
+		if out == nil {
+			return fmt.Errorf("null output %d", i)
+		}
+	}
+	if publicKey != "" {
+		if !isKeyString(publicKey) {
+			return fmt.Errorf("invalid sender_public_key %q", publicKey)
+		}
+		t.senderPublicKey = utils.PublicKeyFromString(publicKey)
+	}
+	if signature != "" {
+		if !isKeyString(signature) {
+			return fmt.Errorf("invalid signature %q", signature)
+		}
+		t.signature = utils.SignatureFromString(signature)
+	}
+	return nil
+}
+
+// isKeyString reports whether s holds two 32 byte numbers in hex, the format
+// of public keys and signatures.
+func isKeyString(s string) bool {
+	if len(s) != 128 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// Validate checks that tr names its chain and holds either a signed account
+// transaction or a UTXO transaction whose inputs are all signed.
 func (tr TransactionRequest) Validate() bool {
-	if tr.RecipientBlockchainAddress == nil || tr.SenderBlockchainAddress == nil || tr.Value == nil || tr.SenderPublicKey == nil || tr.Signature == nil {
+	if tr.ChainID == nil {
 		return false
 	}
-	return true
+	if len(tr.Inputs) > 0 || len(tr.Outputs) > 0 {
+		for _, in := range tr.Inputs {
+			if in == nil || in.PublicKey == nil || in.Signature == nil {
+				return false
+			}
+		}
+		for _, out := range tr.Outputs {
+			if out == nil {
+				return false
+			}
+		}
+		return len(tr.Inputs) > 0 && len(tr.Outputs) > 0
+	}
+	if tr.RecipientBlockchainAddress == nil || tr.SenderBlockchainAddress == nil || tr.Value == nil || tr.Nonce == nil || tr.SenderPublicKey == nil || tr.Signature == nil {
+		return false
+	}
+	return isKeyString(*tr.SenderPublicKey) && isKeyString(*tr.Signature)
 }
 
 // ****************Mining Related ****************//
 
+// Mining mines a block on top of the current tip holding the pool
+// transactions with the best fee rates that fit in MAX_BLOCK_SIZE; the
+// coinbase collects their fees on top of the subsidy. The search runs
+// without bc.mux; it is given up when the tip changes in the meantime or the
+// chain is closed.
 func (bc *BlockChain) Mining() bool {
+	ctx, err := bc.miner.begin(bc.ctx, runtime.GOMAXPROCS(0))
+	if err != nil {
+		log.Printf("ERROR: Mining %v", err)
+		return false
+	}
+	defer bc.miner.end()
+
 	bc.mux.Lock()
-	defer bc.mux.Unlock()
+	// blocks holding only the coinbase are mined too, they are how coins
+	// come into existence
+	coinbase := NewTransaction(bc.params.NetworkID, MINING_SENDER, bc.blockchainAddress, bc.params.Subsidy(len(bc.chain)), 0, uint64(len(bc.chain)))
+	transactions := selectTransactions(bc.CopyTransactionPool(), MAX_BLOCK_SIZE-HEADER_ENCODING_SIZE-coinbase.Size())
+	fees, err := totalFees(transactions)
+	if err == nil {
+		coinbase.value, err = coinbase.value.Add(fees)
+	}
+	if err != nil {
+		bc.mux.Unlock()
+		log.Printf("ERROR: Mining %v", err)
+		return false
+	}
+	transactions = append([]*Transaction{coinbase}, transactions...)
+	tip := bc.LastBlock().Hash()
+	b := NewBlock(0, tip, transactions)
+	// a tip stamped slightly ahead of the local clock still has to be
+	// followed by a later timestamp
+	if prev := bc.LastBlock().header.timeStamp; b.header.timeStamp <= prev {
+		b.header.timeStamp = prev + 1
+	}
+	b.header.chainID = bc.params.NetworkID
+	b.header.bits = nextBits(bc.chain, bc.params)
+	bc.mux.Unlock()
 
-	if len(bc.transactionPool) == 0 {
+	nonce, err := bc.ProofOfWork(ctx, &b.header)
+	if err != nil {
+		log.Printf("action=mining, status=aborted, reason=%v", err)
 		return false
 	}
+	b.header.nonce = nonce
 
-	bc.AddTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD, nil, nil)
-	nonce := bc.ProofOfWork()
-	previousHash := bc.LastBlock().Hash()
-	bc.CreateBlock(nonce, previousHash)
+	bc.mux.Lock()
+	if bc.LastBlock().Hash() != tip {
+		bc.mux.Unlock()
+		log.Println("action=mining, status=stale")
+		return false
+	}
+	// the pool and the clock were read before the search, so the block is
+	// checked like any block from a peer
+	if err := bc.acceptBlock(b); err != nil {
+		bc.mux.Unlock()
+		log.Printf("ERROR: Mined block %v", err)
+		return false
+	}
+	bc.mux.Unlock()
 	log.Println("action=mining, status=success")
+	go bc.broadcastBlock(b)
 	return true
 }
 
 func (bc *BlockChain) StartMining() {
+	if bc.ctx.Err() != nil {
+		return
+	}
 	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
+	_ = time.AfterFunc(time.Second*time.Duration(bc.params.TargetBlockTimeSec), bc.StartMining)
+}
+
+// MiningStatus reports whether a search is running and its hashrate, or the
+// hashrate of the last search.
+func (bc *BlockChain) MiningStatus() *MiningStatus {
+	return bc.miner.status()
 }
@@ -0,0 +1,108 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bc/utils"
+)
+
+// newTestKey returns a fresh key and the address it owns under p.
+func newTestKey(t *testing.T, p *ChainParams) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, utils.BlockchainAddress(&key.PublicKey, p.AddressVersion)
+}
+
+// newTestChain opens a chain on p in memory, mining to a fresh address.
+func newTestChain(t *testing.T, p *ChainParams) *BlockChain {
+	t.Helper()
+	_, miner := newTestKey(t, p)
+	bc, err := NewBlockChainWithParams(miner, 0, NewMemoryStore(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc
+}
+
+func TestBlockUnmarshalRejectsNull(t *testing.T) {
+	b := storeBlocks(2)[1]
+	m, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Block
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	if decoded.Hash() != b.Hash() {
+		t.Fatalf("round trip hash = %x, want %x", decoded.Hash(), b.Hash())
+	}
+
+	h, err := json.Marshal(&b.header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := string(h)
+	input := `{"previous_output":{"txid":"` + strings.Repeat("00", 32) + `","index":0}}`
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"null header", `{"header":null,"transactions":[]}`},
+		{"missing header", `{"transactions":[]}`},
+		{"null transaction", `{"header":` + header + `,"transactions":[null]}`},
+		{"null input", `{"header":` + header + `,"transactions":[{"inputs":[null]}]}`},
+		{"null output", `{"header":` + header + `,"transactions":[{"inputs":[` + input + `],"outputs":[null]}]}`},
+		{"null previous output", `{"header":` + header + `,"transactions":[{"inputs":[{"previous_output":null}]}]}`},
+	}
+	for _, tt := range tests {
+		var b Block
+		if err := json.Unmarshal([]byte(tt.data), &b); err == nil {
+			t.Errorf("%s: decoded without error", tt.name)
+		}
+	}
+}
+
+func TestChainAccessorsWhileMining(t *testing.T) {
+	bc := newTestChain(t, RegtestParams())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if !bc.Mining() {
+				t.Errorf("mining block %d failed", i+1)
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if _, err := bc.MarshalJSON(); err != nil {
+			t.Fatal(err)
+		}
+		bc.TransactionPool()
+	}
+	wg.Wait()
+	m, err := bc.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c struct {
+		Blocks []*Block `json:"chains"`
+	}
+	if err := json.Unmarshal(m, &c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Blocks) != 6 {
+		t.Fatalf("encoded %d blocks, want 6", len(c.Blocks))
+	}
+}
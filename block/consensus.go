@@ -0,0 +1,178 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// ****************Consensus Related ****************//
+
+var neighborClient = &http.Client{Timeout: time.Second * NEIGHBOR_REQUEST_TIMEOUT_SEC}
+
+// Neighbors returns a copy of the neighbors found by the last sync.
+func (bc *BlockChain) Neighbors() []string {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	neighbors := make([]string, len(bc.neighbors))
+	copy(neighbors, bc.neighbors)
+	return neighbors
+}
+
+// blockWork is the expected number of hashes needed to mine b,
+// 2^256 / (target+1).
+func blockWork(b *Block) *big.Int {
+	target := CompactToBig(b.header.bits)
+	if target.Sign() <= 0 {
+		return new(big.Int)
+	}
+	work := new(big.Int).Lsh(big.NewInt(1), 256)
+	return work.Quo(work, target.Add(target, big.NewInt(1)))
+}
+
+// chainWork sums the work of every block after genesis.
+func chainWork(chain []*Block) *big.Int {
+	work := new(big.Int)
+	for i := 1; i < len(chain); i++ {
+		work.Add(work, blockWork(chain[i]))
+	}
+	return work
+}
+
+func fetchChain(neighbor string) ([]*Block, error) {
+	resp, err := neighborClient.Get(fmt.Sprintf("http://%s/", neighbor))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var c struct {
+		Blocks []*Block `json:"chains"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return nil, err
+	}
+	// JSON null decodes to nil, which validation would dereference
+	for i, b := range c.Blocks {
+		if b == nil {
+			return nil, fmt.Errorf("null block %d", i)
+		}
+		for j, t := range b.transactions {
+			if t == nil {
+				return nil, fmt.Errorf("block %d: null transaction %d", i, j)
+			}
+		}
+	}
+	return c.Blocks, nil
+}
+
+// ResolveConflicts replaces the local chain with the valid neighbor chain
+// carrying the most cumulative work, and reports whether it did. Calls made
+// while a resolution runs are merged into a single run after it and report
+// false.
+func (bc *BlockChain) ResolveConflicts() bool {
+	bc.muxResolve.Lock()
+	if bc.resolving {
+		bc.resolvePending = true
+		bc.muxResolve.Unlock()
+		return false
+	}
+	bc.resolving = true
+	bc.muxResolve.Unlock()
+
+	replaced := false
+	for {
+		if bc.resolveConflicts() {
+			replaced = true
+		}
+		bc.muxResolve.Lock()
+		if !bc.resolvePending {
+			bc.resolving = false
+			bc.muxResolve.Unlock()
+			return replaced
+		}
+		bc.resolvePending = false
+		bc.muxResolve.Unlock()
+	}
+}
+
+func (bc *BlockChain) resolveConflicts() bool {
+	bc.mux.Lock()
+	bestWork := chainWork(bc.chain)
+	bc.mux.Unlock()
+	var best []*Block
+	for _, n := range bc.Neighbors() {
+		chain, err := fetchChain(n)
+		if err != nil {
+			log.Printf("ERROR: Fetch chain from %s %v", n, err)
+			continue
+		}
+		// the work claimed by the bits decides whether the chain could win
+		// before the full replay checks that it was really done
+		work := chainWork(chain)
+		if work.Cmp(bestWork) <= 0 {
+			continue
+		}
+		if err := ValidChain(chain, bc.params); err != nil {
+			log.Printf("ERROR: Invalid chain from %s %v", n, err)
+			continue
+		}
+		best, bestWork = chain, work
+	}
+	if best == nil {
+		return false
+	}
+
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bestWork.Cmp(chainWork(bc.chain)) <= 0 {
+		return false
+	}
+	bc.replaceChain(best)
+	log.Println("action=resolve_conflicts, status=replaced")
+	return true
+}
+
+// replaceChain swaps in chain, rewriting the store from the first block
+// where the two chains differ, and aborts a running proof of work search.
+// The transactions of the blocks it orphans return to the pool when still
+// valid. The caller must hold bc.mux.
+func (bc *BlockChain) replaceChain(chain []*Block) {
+	bc.miner.abort()
+	fork := 0
+	for fork < len(bc.chain) && fork < len(chain) && bc.chain[fork].Hash() == chain[fork].Hash() {
+		fork++
+	}
+	orphanedBlocks := bc.chain[fork:len(bc.chain):len(bc.chain)]
+	bc.disconnectBlocks(fork)
+	bc.chain = chain
+	for height := fork; height < len(chain); height++ {
+		bc.connectBlock(chain[height], height)
+	}
+	bc.restoreTransactions(orphanedTransactions(orphanedBlocks))
+	bc.dropIncludedTransactions(chain[fork:])
+	bc.revalidatePool()
+	if len(orphanedBlocks) > 0 {
+		bc.recordReorg(fork, orphanedBlocks)
+	}
+	if err := bc.store.Truncate(fork); err != nil {
+		log.Printf("ERROR: Store truncate %v", err)
+		return
+	}
+	for _, b := range chain[fork:] {
+		if err := bc.store.AppendBlock(b); err != nil {
+			log.Printf("ERROR: Store block %v", err)
+			return
+		}
+	}
+}
+
+func (bc *BlockChain) StartResolveConflicts() {
+	bc.ResolveConflicts()
+	_ = time.AfterFunc(time.Second*BLOCKCHAIN_RESOLVE_CONFLICTS_SEC, bc.StartResolveConflicts)
+}
@@ -0,0 +1,137 @@
+package block
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// serveChain starts a neighbor answering GET / with body and returns its
+// host:port.
+func serveChain(t *testing.T, body string) string {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func TestFetchChain(t *testing.T) {
+	blocks := storeBlocks(2)
+	m, err := json.Marshal(struct {
+		Blocks []*Block `json:"chains"`
+	}{blocks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := fetchChain(serveChain(t, string(m)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != len(blocks) || chain[1].Hash() != blocks[1].Hash() {
+		t.Fatalf("fetched %d blocks, want %d", len(chain), len(blocks))
+	}
+
+	for _, body := range []string{
+		`{"chains":[null]}`,
+		`{"chains":[{"header":null,"transactions":[]}]}`,
+		strings.Replace(string(m), `"transactions":[`, `"transactions":[null,`, 1),
+	} {
+		if _, err := fetchChain(serveChain(t, body)); err == nil {
+			t.Errorf("fetchChain(%.60s) did not fail", body)
+		}
+	}
+}
+
+func TestResolveConflictsMergesOverlappingRuns(t *testing.T) {
+	bc := newTestChain(t, RegtestParams())
+	m, err := bc.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fetches int32
+	started, release := make(chan bool, 1), make(chan bool)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		select {
+		case started <- true:
+		default:
+		}
+		<-release
+		w.Write(m)
+	}))
+	defer s.Close()
+	bc.neighbors = []string{strings.TrimPrefix(s.URL, "http://")}
+
+	done := make(chan bool)
+	go func() { done <- bc.ResolveConflicts() }()
+	<-started
+	for i := 0; i < 5; i++ {
+		if bc.ResolveConflicts() {
+			t.Errorf("merged call %d replaced the chain", i)
+		}
+	}
+	release <- true
+	release <- true
+	if <-done {
+		t.Errorf("equal chain replaced the local one")
+	}
+	if n := atomic.LoadInt32(&fetches); n != 2 {
+		t.Errorf("fetched %d chains, want 2", n)
+	}
+}
+
+func TestReceiveBlockNeedsWorkToResolve(t *testing.T) {
+	p := MainnetParams()
+	bc := newTestChain(t, p)
+	b := orphanHeader(p, 0, false)
+	r, err := bc.receiveBlock(b, "")
+	if err == nil || r.resolve {
+		t.Errorf("unmined block: resolve %v, err %v", r.resolve, err)
+	}
+	b = orphanHeader(p, 0, true)
+	if r, err = bc.receiveBlock(b, ""); err != nil || !r.resolve {
+		t.Errorf("mined block: resolve %v, err %v", r.resolve, err)
+	}
+}
+
+func TestResolveConflictsAdoptsMostWork(t *testing.T) {
+	p := RegtestParams()
+	source := newTestChain(t, p)
+	for i := 0; i < 3; i++ {
+		if !source.Mining() {
+			t.Fatal("mining failed")
+		}
+	}
+	encode := func(chain []*Block) string {
+		m, err := json.Marshal(struct {
+			Blocks []*Block `json:"chains"`
+		}{chain})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(m)
+	}
+	// more claimed work than the valid chain, but its last block does not
+	// follow its parent
+	forged := append(append([]*Block{}, source.chain...), source.chain[3])
+
+	bc := newTestChain(t, p)
+	bc.neighbors = []string{serveChain(t, encode(forged)), serveChain(t, encode(source.chain))}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the heavier valid chain was not adopted")
+	}
+	if len(bc.chain) != 4 || bc.LastBlock().Hash() != source.LastBlock().Hash() {
+		t.Fatalf("adopted %d blocks ending in %x, want 4 ending in %x", len(bc.chain), bc.LastBlock().Hash(), source.LastBlock().Hash())
+	}
+
+	bc.neighbors = []string{serveChain(t, encode(source.chain[:2]))}
+	if bc.ResolveConflicts() {
+		t.Errorf("a lighter chain replaced the local one")
+	}
+}
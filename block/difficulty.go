@@ -0,0 +1,184 @@
+package block
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// ****************Difficulty Related ****************//
+
+// A block hash, read as a 256-bit big-endian number, must not exceed the
+// target of its header. Headers carry the target in the compact "bits" form
+// used by Bitcoin: the top byte is the length of the number in bytes and the
+// low three bytes are its most significant bytes. Every
+// DifficultyAdjustmentInterval blocks of the chain params the target is
+// scaled by the time the last interval took over the time it should have
+// taken, with the factor clamped to [1/MAX_RETARGET_FACTOR,
+// MAX_RETARGET_FACTOR] and the target never above PowLimitBits.
+
+const (
+	MAX_RETARGET_FACTOR = 4
+	// MAX_FUTURE_BLOCK_TIME_SEC bounds how far ahead of local time a block
+	// timestamp may be, so that a peer cannot skew retargeting.
+	MAX_FUTURE_BLOCK_TIME_SEC = 120
+)
+
+// CompactToBig expands bits into the target it encodes. The sign bit makes
+// the target negative, which no hash can meet.
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+	n := big.NewInt(mantissa)
+	if exponent <= 3 {
+		n.Rsh(n, 8*(3-exponent))
+	} else {
+		n.Lsh(n, 8*(exponent-3))
+	}
+	if bits&0x00800000 != 0 {
+		n.Neg(n)
+	}
+	return n
+}
+
+// BigToCompact encodes a non-negative target into bits, dropping all but its
+// three most significant bytes.
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	size := uint((n.BitLen() + 7) / 8)
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(n.Uint64() << (8 * (3 - size)))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(n, 8*(size-3)).Uint64())
+	}
+	// keep the sign bit clear by moving to a longer exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+	return uint32(size)<<24 | mantissa
+}
+
+// targetBytes returns the target of bits as 32 big-endian bytes so hashes can
+// be compared without allocating. ok is false when bits is negative, zero,
+// easier than powLimit or wider than 256 bits.
+func targetBytes(bits uint32, powLimit *big.Int) (target [32]byte, ok bool) {
+	n := CompactToBig(bits)
+	if n.Sign() <= 0 || n.Cmp(powLimit) > 0 || n.BitLen() > 256 {
+		return target, false
+	}
+	n.FillBytes(target[:])
+	return target, true
+}
+
+// meetsTarget reports whether hash, read as a big-endian number, is at most
+// target.
+func meetsTarget(hash, target *[32]byte) bool {
+	return bytes.Compare(hash[:], target[:]) <= 0
+}
+
+// retargetsAt reports whether the block at height gets new bits. The first
+// interval is skipped, it has no full interval before it to measure.
+func retargetsAt(height int, p *ChainParams) bool {
+	interval := p.DifficultyAdjustmentInterval
+	return interval > 0 && height%interval == 0 && height > interval
+}
+
+// blocksUntilRetarget counts the blocks to append to a chain of height
+// blocks before the next one gets new bits, 0 when it is the next block.
+// p.DifficultyAdjustmentInterval must be positive.
+func blocksUntilRetarget(height int, p *ChainParams) int {
+	n := 0
+	for !retargetsAt(height+n, p) {
+		n++
+	}
+	return n
+}
+
+// nextBits returns the target bits of the block following parents.
+func nextBits(parents []*Block, p *ChainParams) uint32 {
+	height := len(parents)
+	last := parents[height-1]
+	interval := p.DifficultyAdjustmentInterval
+	if !retargetsAt(height, p) {
+		return last.header.bits
+	}
+	first := parents[height-1-interval]
+	actual := last.header.timeStamp - first.header.timeStamp
+	expected := int64(interval) * int64(time.Duration(p.TargetBlockTimeSec)*time.Second)
+	if actual < expected/MAX_RETARGET_FACTOR {
+		actual = expected / MAX_RETARGET_FACTOR
+	}
+	if actual > expected*MAX_RETARGET_FACTOR {
+		actual = expected * MAX_RETARGET_FACTOR
+	}
+	target := CompactToBig(last.header.bits)
+	target.Mul(target, big.NewInt(actual))
+	target.Quo(target, big.NewInt(expected))
+	if powLimit := p.powLimit(); target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+	return BigToCompact(target)
+}
+
+// difficultyOf is how many times harder bits is than powLimit.
+func difficultyOf(bits uint32, powLimit *big.Int) float64 {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+	d, _ := new(big.Float).Quo(new(big.Float).SetInt(powLimit), new(big.Float).SetInt(target)).Float64()
+	return d
+}
+
+// averageBlockTime is the mean time between the last n blocks of chain.
+func averageBlockTime(chain []*Block, n int) time.Duration {
+	if n > len(chain)-1 {
+		n = len(chain) - 1
+	}
+	if n <= 0 {
+		return 0
+	}
+	last, first := chain[len(chain)-1], chain[len(chain)-1-n]
+	return time.Duration((last.header.timeStamp - first.header.timeStamp) / int64(n))
+}
+
+type DifficultyResponse struct {
+	Bits                string  `json:"bits"`
+	Target              string  `json:"target"`
+	Difficulty          float64 `json:"difficulty"`
+	AverageBlockTimeSec float64 `json:"average_block_time_sec"`
+	TargetBlockTimeSec  int     `json:"target_block_time_sec"`
+	AdjustmentInterval  int     `json:"adjustment_interval"`
+	BlocksUntilRetarget int     `json:"blocks_until_retarget"`
+}
+
+// Difficulty reports the target of the next block and the average time
+// between the blocks of the last adjustment interval, or of the whole chain
+// when the target never changes. BlocksUntilRetarget is 0 when the next
+// block gets new bits.
+func (bc *BlockChain) Difficulty() *DifficultyResponse {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	p := bc.params
+	height := len(bc.chain)
+	bits := nextBits(bc.chain, p)
+	target, _ := targetBytes(bits, p.powLimit())
+	d := &DifficultyResponse{
+		Bits:                fmt.Sprintf("%08x", bits),
+		Target:              fmt.Sprintf("%x", target),
+		Difficulty:          difficultyOf(bits, p.powLimit()),
+		AverageBlockTimeSec: averageBlockTime(bc.chain, height).Seconds(),
+		TargetBlockTimeSec:  p.TargetBlockTimeSec,
+		AdjustmentInterval:  p.DifficultyAdjustmentInterval,
+	}
+	if interval := p.DifficultyAdjustmentInterval; interval > 0 {
+		d.AverageBlockTimeSec = averageBlockTime(bc.chain, interval).Seconds()
+		d.BlocksUntilRetarget = blocksUntilRetarget(height, p)
+	}
+	return d
+}
@@ -0,0 +1,186 @@
+package block
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func bigFromHex(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("bad hex %q", s)
+	}
+	return n
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0x00000000, "0"},
+		{0x00123456, "0"},
+		{0x01003456, "0"},
+		{0x01123456, "12"},
+		{0x02008000, "80"},
+		{0x02123456, "1234"},
+		{0x03123456, "123456"},
+		{0x04123456, "12345600"},
+		{0x04923456, "-12345600"},
+		{0x05009234, "92340000"},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000"},
+		{0x200fffff, "fffff0000000000000000000000000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		if got := CompactToBig(tt.bits); got.Cmp(bigFromHex(t, tt.want)) != 0 {
+			t.Errorf("CompactToBig(%#08x) = %x, want %s", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		n    string
+		want uint32
+	}{
+		{"0", 0},
+		{"-1", 0},
+		{"12", 0x01120000},
+		{"80", 0x02008000},
+		{"1234", 0x02123400},
+		{"123456", 0x03123456},
+		{"12345600", 0x04123456},
+		// digits below the three most significant bytes are dropped
+		{"123456789", 0x05012345},
+		// a mantissa with the top bit set moves to a longer exponent
+		{"92340000", 0x05009234},
+		{"ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	}
+	for _, tt := range tests {
+		if got := BigToCompact(bigFromHex(t, tt.n)); got != tt.want {
+			t.Errorf("BigToCompact(%s) = %#08x, want %#08x", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, bits := range []uint32{
+		0x01120000, 0x02008000, 0x03123456, 0x04123456, 0x05009234,
+		0x1d00ffff, 0x1f0fffff, 0x200fffff, 0x2100ffff,
+		uint32(MainnetParams().GenesisBits), uint32(RegtestParams().PowLimitBits),
+	} {
+		if got := BigToCompact(CompactToBig(bits)); got != bits {
+			t.Errorf("BigToCompact(CompactToBig(%#08x)) = %#08x", bits, got)
+		}
+	}
+}
+
+func TestTargetBytes(t *testing.T) {
+	powLimit := CompactToBig(0x200fffff)
+	tests := []struct {
+		bits uint32
+		ok   bool
+	}{
+		{0x1f0fffff, true},
+		{0x200fffff, true},
+		{0x00000000, false},
+		{0x04923456, false}, // negative
+		{0x2010ffff, false}, // easier than the limit
+		{0x22010000, false}, // wider than 256 bits
+	}
+	for _, tt := range tests {
+		if _, ok := targetBytes(tt.bits, powLimit); ok != tt.ok {
+			t.Errorf("targetBytes(%#08x) ok = %v, want %v", tt.bits, ok, tt.ok)
+		}
+	}
+	if _, ok := targetBytes(0x22010000, CompactToBig(0x22010000)); ok {
+		t.Errorf("targetBytes accepted a 257 bit target under an equal limit")
+	}
+}
+
+// spacedChain returns n blocks with the given bits, each stamped spacing
+// after its parent.
+func spacedChain(n int, bits uint32, spacing time.Duration) []*Block {
+	chain := make([]*Block, n)
+	for i := range chain {
+		chain[i] = &Block{}
+		chain[i].header.bits = bits
+		chain[i].header.timeStamp = int64(i) * int64(spacing)
+	}
+	return chain
+}
+
+func TestNextBits(t *testing.T) {
+	p := MainnetParams()
+	genesisBits := uint32(p.GenesisBits)
+	powLimitBits := uint32(p.PowLimitBits)
+	target := time.Duration(p.TargetBlockTimeSec) * time.Second
+	scaled := func(bits uint32, num, den int64) uint32 {
+		n := CompactToBig(bits)
+		n.Mul(n, big.NewInt(num))
+		n.Quo(n, big.NewInt(den))
+		return BigToCompact(n)
+	}
+	tests := []struct {
+		name    string
+		height  int
+		bits    uint32
+		spacing time.Duration
+		want    uint32
+	}{
+		{"first interval", p.DifficultyAdjustmentInterval, genesisBits, target / 2, genesisBits},
+		{"between retargets", 2*p.DifficultyAdjustmentInterval + 1, genesisBits, target / 2, genesisBits},
+		{"on target", 2 * p.DifficultyAdjustmentInterval, genesisBits, target, genesisBits},
+		{"twice as fast", 2 * p.DifficultyAdjustmentInterval, genesisBits, target / 2, scaled(genesisBits, 1, 2)},
+		{"twice as slow", 2 * p.DifficultyAdjustmentInterval, genesisBits, 2 * target, scaled(genesisBits, 2, 1)},
+		{"clamped fast", 2 * p.DifficultyAdjustmentInterval, genesisBits, time.Millisecond, scaled(genesisBits, 1, MAX_RETARGET_FACTOR)},
+		{"clamped slow", 2 * p.DifficultyAdjustmentInterval, genesisBits, time.Hour, scaled(genesisBits, MAX_RETARGET_FACTOR, 1)},
+		{"capped at pow limit", 2 * p.DifficultyAdjustmentInterval, powLimitBits, 2 * target, powLimitBits},
+	}
+	for _, tt := range tests {
+		if got := nextBits(spacedChain(tt.height, tt.bits, tt.spacing), p); got != tt.want {
+			t.Errorf("%s: nextBits = %#08x, want %#08x", tt.name, got, tt.want)
+		}
+	}
+
+	regtest := RegtestParams()
+	bits := uint32(regtest.GenesisBits)
+	if got := nextBits(spacedChain(20, bits, time.Hour), regtest); got != bits {
+		t.Errorf("regtest: nextBits = %#08x, want %#08x", got, bits)
+	}
+}
+
+func TestBlocksUntilRetarget(t *testing.T) {
+	p := MainnetParams()
+	interval := p.DifficultyAdjustmentInterval
+	tests := []struct {
+		height int
+		want   int
+	}{
+		{1, 2*interval - 1},
+		{interval - 1, interval + 1},
+		{interval, interval},
+		{interval + 1, interval - 1},
+		{2*interval - 1, 1},
+		{2 * interval, 0},
+		{3 * interval, 0},
+		{3*interval + 1, interval - 1},
+	}
+	for _, tt := range tests {
+		got := blocksUntilRetarget(tt.height, p)
+		if got != tt.want {
+			t.Errorf("blocksUntilRetarget(%d) = %d, want %d", tt.height, got, tt.want)
+		}
+		// the block it points at is the first whose bits nextBits changes
+		target := time.Duration(p.TargetBlockTimeSec) * time.Second
+		genesisBits := uint32(p.GenesisBits)
+		for n := 0; n <= got; n++ {
+			changed := nextBits(spacedChain(tt.height+n, genesisBits, target/2), p) != genesisBits
+			if changed != (n == got) {
+				t.Errorf("height %d: bits change after %d blocks: %v", tt.height, n, changed)
+			}
+		}
+	}
+}
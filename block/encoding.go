@@ -0,0 +1,145 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/bc/utils"
+)
+
+// ****************Encoding Related ****************//
+
+// Hashes and signatures are computed over a canonical binary encoding, never
+// over JSON, which stays an API representation only. Every encoding starts
+// with ENCODING_VERSION and a type byte so that a header can never be read as
+// a transaction or the other way round. Integers are fixed width big-endian,
+// strings are a uvarint byte length followed by the bytes. Every encoding
+// also carries the network id of the chain params right after the type byte,
+// so a signature or a block of one network is never valid on another.
+//
+// Transaction signing payload, version 2:
+//
+//	version      1 byte   0x02
+//	type         1 byte   0x01 (ENCODING_TYPE_TRANSACTION)
+//	chain id     4 bytes  uint32
+//	sender       uvarint length + bytes
+//	receiver     uvarint length + bytes
+//	value        8 bytes  int64, base units
+//	fee          8 bytes  int64, base units
+//	nonce        8 bytes  uint64
+//
+// UTXO transaction signing payload, version 2:
+//
+//	version      1 byte   0x02
+//	type         1 byte   0x03 (ENCODING_TYPE_UTXO)
+//	chain id     4 bytes  uint32
+//	inputs       uvarint count, then per input:
+//	  txid        32 bytes
+//	  index        4 bytes  uint32
+//	outputs      uvarint count, then per output:
+//	  address      uvarint length + bytes
+//	  value        8 bytes  int64, base units
+//	fee          8 bytes  int64, base units
+//
+// Block header, version 2 (HEADER_ENCODING_SIZE bytes):
+//
+//	version        1 byte   0x02
+//	type           1 byte   0x02 (ENCODING_TYPE_HEADER)
+//	chain id       4 bytes  uint32
+//	timestamp      8 bytes  int64, unix nanoseconds
+//	nonce          8 bytes  int64
+//	bits           4 bytes  uint32, compact target
+//	previous hash 32 bytes
+//	merkle root   32 bytes
+//
+// A transaction id is the SHA-256 of its signing payload, and the sender
+// signs that same digest. A block hash is the SHA-256 of its header.
+
+const (
+	ENCODING_VERSION          byte = 0x02
+	ENCODING_TYPE_TRANSACTION byte = 0x01
+	ENCODING_TYPE_HEADER      byte = 0x02
+	ENCODING_TYPE_UTXO        byte = 0x03
+	HEADER_ENCODING_SIZE           = 1 + 1 + 4 + 8 + 8 + 4 + 32 + 32
+	headerNonceOffset              = 1 + 1 + 4 + 8
+)
+
+// EncodeTransactionPayload returns the canonical encoding of the signed
+// fields of a transaction on the chain chainID.
+func EncodeTransactionPayload(chainID uint32, sender, receiver string, value, fee utils.Amount, nonce uint64) []byte {
+	buf := make([]byte, 0, 6+2*binary.MaxVarintLen64+len(sender)+len(receiver)+24)
+	buf = append(buf, ENCODING_VERSION, ENCODING_TYPE_TRANSACTION)
+	buf = appendUint32(buf, chainID)
+	buf = appendString(buf, sender)
+	buf = appendString(buf, receiver)
+	buf = appendUint64(buf, uint64(value))
+	buf = appendUint64(buf, uint64(fee))
+	buf = appendUint64(buf, nonce)
+	return buf
+}
+
+// TransactionSigningHash is the digest a wallet signs for a transaction.
+func TransactionSigningHash(chainID uint32, sender, receiver string, value, fee utils.Amount, nonce uint64) [32]byte {
+	return sha256.Sum256(EncodeTransactionPayload(chainID, sender, receiver, value, fee, nonce))
+}
+
+// EncodeUTXOTransactionPayload returns the canonical encoding of the signed
+// fields of a UTXO transaction on the chain chainID. The keys and signatures
+// of the inputs are not part of it.
+func EncodeUTXOTransactionPayload(chainID uint32, inputs []*TxInput, outputs []*TxOutput, fee utils.Amount) []byte {
+	buf := make([]byte, 0, 6+2*binary.MaxVarintLen64+len(inputs)*36+len(outputs)*(binary.MaxVarintLen64+48)+8)
+	buf = append(buf, ENCODING_VERSION, ENCODING_TYPE_UTXO)
+	buf = appendUint32(buf, chainID)
+	buf = appendUvarint(buf, uint64(len(inputs)))
+	for _, in := range inputs {
+		buf = append(buf, in.PreviousOutput.TxID[:]...)
+		buf = appendUint32(buf, in.PreviousOutput.Index)
+	}
+	buf = appendUvarint(buf, uint64(len(outputs)))
+	for _, out := range outputs {
+		buf = appendString(buf, out.Address)
+		buf = appendUint64(buf, uint64(out.Value))
+	}
+	return appendUint64(buf, uint64(fee))
+}
+
+// Encode returns the canonical encoding of h.
+func (h *BlockHeader) Encode() []byte {
+	buf := make([]byte, 0, HEADER_ENCODING_SIZE)
+	buf = append(buf, ENCODING_VERSION, ENCODING_TYPE_HEADER)
+	buf = appendUint32(buf, h.chainID)
+	buf = appendUint64(buf, uint64(h.timeStamp))
+	buf = appendUint64(buf, uint64(h.nonce))
+	buf = appendUint32(buf, h.bits)
+	buf = append(buf, h.previousHash[:]...)
+	buf = append(buf, h.merkleRoot[:]...)
+	return buf
+}
+
+// setEncodedNonce overwrites the nonce of a header encoding in place, letting
+// the proof of work search hash without re-encoding.
+func setEncodedNonce(encoded []byte, nonce int) {
+	binary.BigEndian.PutUint64(encoded[headerNonceOffset:], uint64(nonce))
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var n [binary.MaxVarintLen64]byte
+	return append(buf, n[:binary.PutUvarint(n[:], v)]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return append(buf, b[:]...)
+}
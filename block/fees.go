@@ -0,0 +1,167 @@
+package block
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bc/utils"
+)
+
+// ****************Fee Related ****************//
+
+// The size of a transaction is the length of its signing payload plus its
+// public key and signature. A block may hold MAX_BLOCK_SIZE bytes counting
+// its encoded header. Miners fill it by fee rate, the fee paid per byte.
+
+const (
+	MAX_BLOCK_SIZE           = 100000
+	TRANSACTION_WITNESS_SIZE = 64 + 64 // public key and signature
+	TYPICAL_TRANSACTION_SIZE = 2 + 1 + 34 + 1 + 34 + 24 + TRANSACTION_WITNESS_SIZE
+	FEE_ESTIMATE_BLOCKS      = 10
+)
+
+// Size is the number of bytes t takes in a block.
+func (t *Transaction) Size() int {
+	if t.isUTXO() {
+		return len(EncodeUTXOTransactionPayload(t.chainID, t.inputs, t.outputs, t.fee)) + TRANSACTION_WITNESS_SIZE*len(t.inputs)
+	}
+	size := len(EncodeTransactionPayload(t.chainID, t.senderBlockchainAddress, t.receiverBlockchainAddress, t.value, t.fee, t.nonce))
+	if t.signature != nil {
+		size += TRANSACTION_WITNESS_SIZE
+	}
+	return size
+}
+
+// feeRate is the fee of t in base units per byte, rounded up.
+func (t *Transaction) feeRate() utils.Amount {
+	size := utils.Amount(t.Size())
+	return (t.fee + size - 1) / size
+}
+
+func blockSize(b *Block) int {
+	size := HEADER_ENCODING_SIZE
+	for _, t := range b.transactions {
+		size += t.Size()
+	}
+	return size
+}
+
+func totalFees(transactions []*Transaction) (utils.Amount, error) {
+	var fees utils.Amount
+	var err error
+	for _, t := range transactions {
+		if fees, err = fees.Add(t.fee); err != nil {
+			return 0, err
+		}
+	}
+	return fees, nil
+}
+
+// selectTransactions picks from pool the transactions with the best fee rates
+// that fit in space bytes. pool is in arrival order, which is nonce order for
+// each sender, so only the oldest remaining transaction of a sender competes
+// at any time; once it does not fit, the rest of that sender waits for a later
+// block. UTXO transactions only spend confirmed outputs and compete alone.
+func selectTransactions(pool []*Transaction, space int) []*Transaction {
+	var queues [][]*Transaction
+	queueOf := make(map[string]int)
+	for _, t := range pool {
+		key := t.senderBlockchainAddress
+		if t.isUTXO() {
+			key = fmt.Sprintf("%x", t.ID())
+		}
+		i, ok := queueOf[key]
+		if !ok {
+			i = len(queues)
+			queueOf[key] = i
+			queues = append(queues, nil)
+		}
+		queues[i] = append(queues[i], t)
+	}
+	selected := make([]*Transaction, 0, len(pool))
+	for {
+		best := -1
+		for i, q := range queues {
+			if len(q) > 0 && (best < 0 || higherFeeRate(q[0], queues[best][0])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			return selected
+		}
+		t := queues[best][0]
+		if size := t.Size(); size <= space {
+			selected = append(selected, t)
+			space -= size
+			queues[best] = queues[best][1:]
+		} else {
+			queues[best] = nil
+		}
+	}
+}
+
+func higherFeeRate(a, b *Transaction) bool {
+	return float64(a.fee)*float64(b.Size()) > float64(b.fee)*float64(a.Size())
+}
+
+type FeeEstimate struct {
+	FeeRate             utils.Amount `json:"fee_rate"`
+	Fee                 utils.Amount `json:"fee"`
+	TransactionSize     int          `json:"transaction_size"`
+	RecentMedianFeeRate utils.Amount `json:"recent_median_fee_rate"`
+	MempoolTransactions int          `json:"mempool_transactions"`
+	MempoolBytes        int          `json:"mempool_bytes"`
+	MaxBlockSize        int          `json:"max_block_size"`
+}
+
+// EstimateFee suggests a fee rate for a transaction to be mined soon: the
+// median fee rate of the last FEE_ESTIMATE_BLOCKS blocks, raised above the
+// lowest fee rate that still makes it into the next block when the pool holds
+// more than one block. Fee is that rate applied to TYPICAL_TRANSACTION_SIZE.
+func (bc *BlockChain) EstimateFee() *FeeEstimate {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	e := &FeeEstimate{TransactionSize: TYPICAL_TRANSACTION_SIZE, MaxBlockSize: MAX_BLOCK_SIZE}
+
+	var rates []utils.Amount
+	start := len(bc.chain) - FEE_ESTIMATE_BLOCKS
+	if start < 1 {
+		start = 1
+	}
+	for _, b := range bc.chain[start:] {
+		for _, t := range b.transactions {
+			if t.senderBlockchainAddress != MINING_SENDER {
+				rates = append(rates, t.feeRate())
+			}
+		}
+	}
+	if len(rates) > 0 {
+		sort.Slice(rates, func(i, j int) bool { return rates[i] < rates[j] })
+		e.RecentMedianFeeRate = rates[len(rates)/2]
+	}
+	e.FeeRate = e.RecentMedianFeeRate
+
+	e.MempoolTransactions = len(bc.transactionPool)
+	for _, t := range bc.transactionPool {
+		e.MempoolBytes += t.Size()
+	}
+	coinbase := NewTransaction(bc.params.NetworkID, MINING_SENDER, bc.blockchainAddress, bc.params.Subsidy(len(bc.chain)), 0, uint64(len(bc.chain)))
+	selected := selectTransactions(bc.transactionPool, MAX_BLOCK_SIZE-HEADER_ENCODING_SIZE-coinbase.Size())
+	if len(selected) < len(bc.transactionPool) && len(selected) > 0 {
+		lowest := selected[0].feeRate()
+		for _, t := range selected[1:] {
+			if r := t.feeRate(); r < lowest {
+				lowest = r
+			}
+		}
+		if lowest+1 > e.FeeRate {
+			e.FeeRate = lowest + 1
+		}
+	}
+	fee, err := e.FeeRate.Mul(TYPICAL_TRANSACTION_SIZE)
+	if err != nil {
+		fee = utils.MAX_AMOUNT
+	}
+	e.Fee = fee
+	return e
+}
@@ -0,0 +1,173 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ****************Gossip Related ****************//
+
+// seen reports whether id was accepted recently. Ids are forgotten after
+// SEEN_TRANSACTION_TTL_SEC so the set does not grow forever.
+func (bc *BlockChain) seen(id [32]byte) bool {
+	bc.muxSeen.Lock()
+	defer bc.muxSeen.Unlock()
+	now := time.Now().Unix()
+	for seenID, seenAt := range bc.seenTransactions {
+		if now-seenAt > SEEN_TRANSACTION_TTL_SEC {
+			delete(bc.seenTransactions, seenID)
+		}
+	}
+	_, ok := bc.seenTransactions[id]
+	return ok
+}
+
+func (bc *BlockChain) markSeen(id [32]byte) {
+	bc.muxSeen.Lock()
+	defer bc.muxSeen.Unlock()
+	if bc.seenTransactions == nil {
+		bc.seenTransactions = make(map[[32]byte]int64)
+	}
+	bc.seenTransactions[id] = time.Now().Unix()
+}
+
+// broadcastTransaction relays t to every neighbor with PUT /transactions.
+func (bc *BlockChain) broadcastTransaction(t *Transaction) {
+	if t.isUTXO() {
+		m, _ := json.Marshal(&TransactionRequest{ChainID: &t.chainID, Fee: &t.fee, Inputs: t.inputs, Outputs: t.outputs})
+		for _, n := range bc.Neighbors() {
+			go bc.putToNeighbor(n, "/transactions", m)
+		}
+		return
+	}
+	publicKey := fmt.Sprintf("%064x%064x", t.senderPublicKey.X, t.senderPublicKey.Y)
+	signature := t.signature.String()
+	m, _ := json.Marshal(&TransactionRequest{
+		ChainID:                    &t.chainID,
+		SenderPublicKey:            &publicKey,
+		SenderBlockchainAddress:    &t.senderBlockchainAddress,
+		RecipientBlockchainAddress: &t.receiverBlockchainAddress,
+		Value:                      &t.value,
+		Fee:                        &t.fee,
+		Nonce:                      &t.nonce,
+		Signature:                  &signature,
+	})
+	for _, n := range bc.Neighbors() {
+		go bc.putToNeighbor(n, "/transactions", m)
+	}
+}
+
+// broadcastBlock announces b to every neighbor with PUT /blocks.
+func (bc *BlockChain) broadcastBlock(b *Block) {
+	m, _ := json.Marshal(b)
+	for _, n := range bc.Neighbors() {
+		go bc.putToNeighbor(n, "/blocks", m)
+	}
+}
+
+// ReceiveBlock handles a block announced by peer, the host:port of the
+// sending node or empty when unknown. A block extending the local tip is
+// validated, appended and relayed together with the orphans it completes. A
+// block with an unknown parent waits in the orphan pool while the parent is
+// requested from peer; any other block that does not fit starts a full
+// conflict resolution. It reports whether b was appended.
+func (bc *BlockChain) ReceiveBlock(b *Block, peer string) bool {
+	if b.header.chainID != bc.params.NetworkID {
+		log.Printf("ERROR: Received block %v: %d", ErrChainIDMismatch, b.header.chainID)
+		return false
+	}
+	r, err := bc.receiveBlock(b, peer)
+	if err != nil {
+		log.Printf("ERROR: Received block %v", err)
+		return false
+	}
+	switch {
+	case r.orphan:
+		log.Printf("action=receive_block, status=orphan, previous_hash=%x", b.header.previousHash)
+		if r.request {
+			go bc.requestBlock(peer, b.header.previousHash)
+		}
+	case r.resolve:
+		log.Printf("action=receive_block, status=unknown_parent, previous_hash=%x", b.header.previousHash)
+		go bc.ResolveConflicts()
+	case len(r.appended) > 0:
+		log.Printf("action=receive_block, status=appended, blocks=%d", len(r.appended))
+		for _, a := range r.appended {
+			bc.broadcastBlock(a)
+		}
+		return true
+	}
+	return false
+}
+
+// receipt is what receiveBlock did with a block. A known block leaves it
+// empty.
+type receipt struct {
+	appended []*Block // the block and the orphans it connected
+	orphan   bool     // the block waits in the orphan pool
+	request  bool     // the parent of the orphan must be requested
+	resolve  bool     // the block does not fit, the chain must be resolved
+}
+
+// receiveBlock is the part of ReceiveBlock run under bc.mux.
+func (bc *BlockChain) receiveBlock(b *Block, peer string) (r receipt, err error) {
+	hash := b.Hash()
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if _, ok := bc.blockIndex[hash]; ok {
+		return r, nil
+	}
+	if b.header.previousHash != bc.LastBlock().Hash() {
+		if _, known := bc.blockIndex[b.header.previousHash]; !known && peer != "" {
+			if r.request, err = bc.addOrphan(b, hash, peer); err != nil {
+				return r, err
+			}
+			r.orphan = true
+			return r, nil
+		}
+		// a resolution downloads every neighbor chain, so it has to be
+		// paid for with proof of work
+		if err := checkHeader(&b.header, bc.params); err != nil {
+			return r, err
+		}
+		r.resolve = true
+		return r, nil
+	}
+	if err := bc.acceptBlock(b); err != nil {
+		return r, err
+	}
+	r.appended = append([]*Block{b}, bc.connectOrphans()...)
+	return r, nil
+}
+
+// acceptBlock validates b against the tip and the ledger and appends it. The
+// caller must hold bc.mux.
+func (bc *BlockChain) acceptBlock(b *Block) error {
+	if err := validBlock(b, bc.chain, bc.params); err != nil {
+		return err
+	}
+	if err := bc.checkLedger(b, len(bc.chain)); err != nil {
+		return err
+	}
+	bc.appendBlock(b)
+	return nil
+}
+
+// putToNeighbor sends m to endpoint of neighbor, naming the port of bc so
+// that the neighbor can ask back.
+func (bc *BlockChain) putToNeighbor(neighbor, endpoint string, m []byte) {
+	req, _ := http.NewRequest(http.MethodPut, fmt.Sprintf("http://%s%s", neighbor, endpoint), bytes.NewBuffer(m))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(NODE_PORT_HEADER, strconv.Itoa(int(bc.port)))
+	resp, err := neighborClient.Do(req)
+	if err != nil {
+		log.Printf("ERROR: Relay to %s %v", neighbor, err)
+		return
+	}
+	resp.Body.Close()
+}
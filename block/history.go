@@ -0,0 +1,137 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/bc/utils"
+)
+
+// ****************Address History Related ****************//
+
+// An address history lists the transactions that changed the balance of an
+// address, newest first. Pages of confirmed transactions are chained by a
+// cursor naming the position "height:index" of the last transaction served;
+// the first page also carries the pool transactions of the address, flagged
+// as unconfirmed.
+
+const (
+	ADDRESS_HISTORY_PAGE_SIZE     = 20
+	ADDRESS_HISTORY_MAX_PAGE_SIZE = 100
+	DIRECTION_INCOMING            = "incoming"
+	DIRECTION_OUTGOING            = "outgoing"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type AddressTransaction struct {
+	ID            string        `json:"id"`
+	Confirmed     bool          `json:"confirmed"`
+	BlockHeight   *int          `json:"block_height,omitempty"`
+	Timestamp     int64         `json:"timestamp,omitempty"`
+	Direction     string        `json:"direction"`
+	Counterparty  string        `json:"counterparty"`
+	Amount        utils.Amount  `json:"amount"`
+	Fee           utils.Amount  `json:"fee"`
+	Confirmations int           `json:"confirmations"`
+	Balance       *utils.Amount `json:"balance,omitempty"`
+}
+
+type AddressHistory struct {
+	Address      string                `json:"address"`
+	Balance      utils.Amount          `json:"balance"`
+	Transactions []*AddressTransaction `json:"transactions"`
+	NextCursor   string                `json:"next_cursor,omitempty"`
+}
+
+func newAddressTransaction(t *Transaction, c balanceChange) *AddressTransaction {
+	at := &AddressTransaction{
+		ID:           fmt.Sprintf("%x", t.ID()),
+		Direction:    DIRECTION_INCOMING,
+		Counterparty: c.counterparty,
+		Amount:       c.amount,
+		Fee:          t.fee,
+	}
+	if c.amount < 0 {
+		at.Direction = DIRECTION_OUTGOING
+	}
+	return at
+}
+
+// AddressTransactions returns up to limit confirmed transactions of
+// blockchainAddress older than cursor, or the newest ones when cursor is
+// empty, in which case its pool transactions come first.
+func (bc *BlockChain) AddressTransactions(blockchainAddress, cursor string, limit int) (*AddressHistory, error) {
+	if limit <= 0 {
+		limit = ADDRESS_HISTORY_PAGE_SIZE
+	}
+	if limit > ADDRESS_HISTORY_MAX_PAGE_SIZE {
+		limit = ADDRESS_HISTORY_MAX_PAGE_SIZE
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	history := bc.addresses.history[blockchainAddress]
+	ah := &AddressHistory{
+		Address:      blockchainAddress,
+		Balance:      bc.addresses.balances[blockchainAddress],
+		Transactions: make([]*AddressTransaction, 0),
+	}
+
+	end := len(history)
+	if cursor == "" {
+		ah.Transactions = append(ah.Transactions, bc.pendingAddressTransactions(blockchainAddress)...)
+	} else {
+		var height, index int
+		if n, err := fmt.Sscanf(cursor, "%d:%d", &height, &index); err != nil || n != 2 || fmt.Sprintf("%d:%d", height, index) != cursor {
+			return nil, fmt.Errorf("%w %q", ErrInvalidCursor, cursor)
+		}
+		end = sort.Search(len(history), func(i int) bool {
+			e := history[i]
+			return e.height > height || (e.height == height && e.index >= index)
+		})
+	}
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	for i := end - 1; i >= start; i-- {
+		e := history[i]
+		b := bc.chain[e.height]
+		height, balance := e.height, e.balance
+		at := newAddressTransaction(b.transactions[e.index], balanceChange{amount: e.amount, counterparty: e.counterparty})
+		at.Confirmed = true
+		at.BlockHeight = &height
+		at.Timestamp = b.header.timeStamp
+		at.Confirmations = len(bc.chain) - e.height
+		at.Balance = &balance
+		ah.Transactions = append(ah.Transactions, at)
+	}
+	if start > 0 {
+		ah.NextCursor = fmt.Sprintf("%d:%d", history[start].height, history[start].index)
+	}
+	return ah, nil
+}
+
+// pendingAddressTransactions lists the pool transactions of
+// blockchainAddress, newest first. The caller must hold bc.mux.
+func (bc *BlockChain) pendingAddressTransactions(blockchainAddress string) []*AddressTransaction {
+	var pending []*AddressTransaction
+	for i := len(bc.transactionPool) - 1; i >= 0; i-- {
+		t := bc.transactionPool[i]
+		var spent []spentOutput
+		if bc.utxos != nil {
+			for _, input := range t.inputs {
+				if e, ok := bc.utxos.entries[input.PreviousOutput]; ok {
+					spent = append(spent, spentOutput{outPoint: input.PreviousOutput, entry: e})
+				}
+			}
+		}
+		for _, c := range balanceChanges(t, spent) {
+			if c.address == blockchainAddress {
+				pending = append(pending, newAddressTransaction(t, c))
+			}
+		}
+	}
+	return pending
+}
@@ -0,0 +1,72 @@
+package block
+
+import "fmt"
+
+// ****************Index Related ****************//
+
+const (
+	TRANSACTION_PENDING   = "pending"
+	TRANSACTION_CONFIRMED = "confirmed"
+	TRANSACTION_UNKNOWN   = "unknown"
+)
+
+type TransactionStatus struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	BlockHeight   *int   `json:"block_height,omitempty"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// ParseTransactionID reads a transaction id written as 64 hex characters.
+func ParseTransactionID(s string) ([32]byte, error) {
+	return decodeHash("transaction id", s)
+}
+
+// indexBlock records the height of b and of its transactions. The caller
+// must hold bc.mux.
+func (bc *BlockChain) indexBlock(b *Block, height int) {
+	if bc.transactionIndex == nil {
+		bc.transactionIndex = make(map[[32]byte]int)
+	}
+	if bc.blockIndex == nil {
+		bc.blockIndex = make(map[[32]byte]int)
+	}
+	bc.blockIndex[b.Hash()] = height
+	for _, t := range b.transactions {
+		bc.transactionIndex[t.ID()] = height
+	}
+}
+
+// unindexBlocks forgets the blocks from height up and their transactions.
+// The caller must hold bc.mux.
+func (bc *BlockChain) unindexBlocks(height int) {
+	for _, b := range bc.chain[height:] {
+		delete(bc.blockIndex, b.Hash())
+		for _, t := range b.transactions {
+			delete(bc.transactionIndex, t.ID())
+		}
+	}
+}
+
+// TransactionStatus reports whether the transaction id waits in the pool or
+// was confirmed, and where.
+func (bc *BlockChain) TransactionStatus(id [32]byte) *TransactionStatus {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	ts := &TransactionStatus{ID: fmt.Sprintf("%x", id), Status: TRANSACTION_UNKNOWN}
+	if height, ok := bc.transactionIndex[id]; ok {
+		ts.Status = TRANSACTION_CONFIRMED
+		ts.BlockHeight = &height
+		ts.BlockHash = fmt.Sprintf("%x", bc.chain[height].Hash())
+		ts.Confirmations = len(bc.chain) - height
+		return ts
+	}
+	for _, t := range bc.transactionPool {
+		if t.ID() == id {
+			ts.Status = TRANSACTION_PENDING
+			break
+		}
+	}
+	return ts
+}
@@ -0,0 +1,103 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ****************Block Lookup Related ****************//
+
+const (
+	BLOCK_PAGE_SIZE     = 20
+	BLOCK_MAX_PAGE_SIZE = 100
+)
+
+var ErrBlockNotFound = errors.New("block not found")
+
+// BlockResponse is a block as served to explorers and light clients. Its
+// header and transactions read back as a Block.
+type BlockResponse struct {
+	Hash             string         `json:"hash"`
+	Height           int            `json:"height"`
+	TransactionCount int            `json:"transaction_count"`
+	Size             int            `json:"size"`
+	Confirmations    int            `json:"confirmations"`
+	Header           *BlockHeader   `json:"header"`
+	Transactions     []*Transaction `json:"transactions"`
+}
+
+type BlockPage struct {
+	Blocks   []*BlockResponse `json:"blocks"`
+	NextFrom *int             `json:"next_from,omitempty"`
+}
+
+// ParseBlockHash reads a block hash written as 64 hex characters.
+func ParseBlockHash(s string) ([32]byte, error) {
+	return decodeHash("block hash", s)
+}
+
+// blockResponse describes the block at height. The caller must hold bc.mux.
+func (bc *BlockChain) blockResponse(height int) *BlockResponse {
+	b := bc.chain[height]
+	return &BlockResponse{
+		Hash:             fmt.Sprintf("%x", b.Hash()),
+		Height:           height,
+		TransactionCount: len(b.transactions),
+		Size:             blockSize(b),
+		Confirmations:    len(bc.chain) - height,
+		Header:           &b.header,
+		Transactions:     b.transactions,
+	}
+}
+
+// BlockByHeight returns the block at height on the chain.
+func (bc *BlockChain) BlockByHeight(height int) (*BlockResponse, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if height < 0 || height >= len(bc.chain) {
+		return nil, fmt.Errorf("%w at height %d", ErrBlockNotFound, height)
+	}
+	return bc.blockResponse(height), nil
+}
+
+// BlockByHash returns the block of the chain whose hash is hash.
+func (bc *BlockChain) BlockByHash(hash [32]byte) (*BlockResponse, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	height, ok := bc.blockIndex[hash]
+	if !ok {
+		return nil, fmt.Errorf("%w with hash %x", ErrBlockNotFound, hash)
+	}
+	return bc.blockResponse(height), nil
+}
+
+// LatestBlock returns the tip of the chain.
+func (bc *BlockChain) LatestBlock() *BlockResponse {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.blockResponse(len(bc.chain) - 1)
+}
+
+// Blocks returns up to limit blocks from height from up, with the height to
+// continue from when more follow.
+func (bc *BlockChain) Blocks(from, limit int) *BlockPage {
+	if limit <= 0 {
+		limit = BLOCK_PAGE_SIZE
+	}
+	if limit > BLOCK_MAX_PAGE_SIZE {
+		limit = BLOCK_MAX_PAGE_SIZE
+	}
+	if from < 0 {
+		from = 0
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	page := &BlockPage{Blocks: make([]*BlockResponse, 0, limit)}
+	for height := from; height < len(bc.chain) && height < from+limit; height++ {
+		page.Blocks = append(page.Blocks, bc.blockResponse(height))
+	}
+	if next := from + limit; next < len(bc.chain) {
+		page.NextFrom = &next
+	}
+	return page
+}
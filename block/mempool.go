@@ -0,0 +1,255 @@
+package block
+
+import (
+	"errors"
+
+	"github.com/bc/utils"
+)
+
+// ****************Transaction Pool Related ****************//
+
+var (
+	ErrInvalidValue         = errors.New("value must be positive")
+	ErrInvalidFee           = errors.New("fee must not be negative")
+	ErrInvalidSignature     = errors.New("invalid transaction signature")
+	ErrDuplicateTransaction = errors.New("duplicate transaction")
+	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrInvalidNonce         = errors.New("invalid nonce")
+	ErrCoinbaseTransaction  = errors.New("coinbase transactions are only created by miners")
+)
+
+// pendingOutflow sums what blockchainAddress sends and pays in fees in the
+// transaction pool.
+func (bc *BlockChain) pendingOutflow(blockchainAddress string) (utils.Amount, error) {
+	var outflow utils.Amount
+	for _, t := range bc.transactionPool {
+		if t.senderBlockchainAddress == blockchainAddress {
+			cost, err := t.cost()
+			if err != nil {
+				return 0, err
+			}
+			if outflow, err = outflow.Add(cost); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return outflow, nil
+}
+
+// spendableBalance is the confirmed balance of blockchainAddress minus its
+// immature coinbase rewards and what it already spends in the transaction
+// pool. The caller must hold bc.mux.
+func (bc *BlockChain) spendableBalance(blockchainAddress string) (utils.Amount, error) {
+	if bc.utxos != nil {
+		return bc.spendableUTXOBalance(blockchainAddress)
+	}
+	a := newAccounts(bc.params.CoinbaseMaturity)
+	bc.loadAccount(a, blockchainAddress)
+	outflow, err := bc.pendingOutflow(blockchainAddress)
+	if err != nil {
+		return 0, err
+	}
+	return a.mature(blockchainAddress, len(bc.chain)).Sub(outflow)
+}
+
+// confirmedNonce counts the transactions blockchainAddress sent on the chain,
+// which is the nonce its next transaction must carry. The caller must hold
+// bc.mux.
+func (bc *BlockChain) confirmedNonce(blockchainAddress string) uint64 {
+	return bc.addresses.nonces[blockchainAddress]
+}
+
+// nextNonce is the nonce of the next transaction from blockchainAddress,
+// counting the ones waiting in the pool. The caller must hold bc.mux.
+func (bc *BlockChain) nextNonce(blockchainAddress string) uint64 {
+	nonce := bc.confirmedNonce(blockchainAddress)
+	for _, t := range bc.transactionPool {
+		if t.senderBlockchainAddress == blockchainAddress {
+			nonce++
+		}
+	}
+	return nonce
+}
+
+// NextNonce returns the nonce a new transaction from blockchainAddress must
+// carry to be accepted.
+func (bc *BlockChain) NextNonce(blockchainAddress string) uint64 {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.nextNonce(blockchainAddress)
+}
+
+// SpendableBalance returns what blockchainAddress can still send.
+func (bc *BlockChain) SpendableBalance(blockchainAddress string) (utils.Amount, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.spendableBalance(blockchainAddress)
+}
+
+// revalidatePool keeps, in order, the pool transactions that still carry
+// their sender's next nonce and that the sender can still cover with mature
+// coins against the current chain. It runs whenever the chain changes. The
+// caller must hold bc.mux.
+func (bc *BlockChain) revalidatePool() {
+	if bc.utxos != nil {
+		bc.revalidateUTXOPool()
+		return
+	}
+	accounts := newAccounts(bc.params.CoinbaseMaturity)
+	height := len(bc.chain)
+	transactionPool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		sender := t.senderBlockchainAddress
+		if sender == MINING_SENDER {
+			continue
+		}
+		bc.loadAccount(accounts, sender)
+		cost, err := t.cost()
+		if err != nil || t.nonce != accounts.nonces[sender] || accounts.mature(sender, height) < cost {
+			continue
+		}
+		accounts.balances[sender] -= cost
+		accounts.nonces[sender]++
+		transactionPool = append(transactionPool, t)
+	}
+	if len(transactionPool) != len(bc.transactionPool) {
+		bc.transactionPool = transactionPool
+		bc.saveTransactionPool()
+	}
+}
+
+// accounts tracks the balance, the next nonce and the coinbase rewards not
+// yet maturity blocks deep of addresses while transactions are replayed.
+// Genesis allocations are mature at once.
+type accounts struct {
+	balances  map[string]utils.Amount
+	nonces    map[string]uint64
+	coinbases map[string][]coinbaseCredit
+	maturity  int
+}
+
+// coinbaseCredit is a coinbase reward paid at height.
+type coinbaseCredit struct {
+	height int
+	value  utils.Amount
+}
+
+func newAccounts(maturity int) *accounts {
+	return &accounts{
+		balances:  make(map[string]utils.Amount),
+		nonces:    make(map[string]uint64),
+		coinbases: make(map[string][]coinbaseCredit),
+		maturity:  maturity,
+	}
+}
+
+// mature is the balance of blockchainAddress a transaction in a block at
+// height may spend: coinbase rewards paid less than a.maturity blocks
+// earlier are held back.
+func (a *accounts) mature(blockchainAddress string, height int) utils.Amount {
+	balance := a.balances[blockchainAddress]
+	for _, c := range a.coinbases[blockchainAddress] {
+		if height-c.height < a.maturity {
+			balance -= c.value
+		}
+	}
+	return balance
+}
+
+// addCoinbase records a coinbase reward of value paid to blockchainAddress
+// at height, dropping the rewards already a.maturity blocks deep so that the
+// list never holds more than a.maturity of them.
+func (a *accounts) addCoinbase(blockchainAddress string, height int, value utils.Amount) {
+	credits := a.coinbases[blockchainAddress]
+	for len(credits) > 0 && height-credits[0].height >= a.maturity {
+		credits = credits[1:]
+	}
+	a.coinbases[blockchainAddress] = append(credits, coinbaseCredit{height: height, value: value})
+}
+
+// loadAccount seeds accounts with the confirmed state of blockchainAddress
+// unless it is already tracked. The caller must hold bc.mux.
+func (bc *BlockChain) loadAccount(a *accounts, blockchainAddress string) {
+	if _, ok := a.nonces[blockchainAddress]; ok {
+		return
+	}
+	a.balances[blockchainAddress] = bc.calculateTotal(blockchainAddress)
+	a.nonces[blockchainAddress] = bc.confirmedNonce(blockchainAddress)
+	start := len(bc.chain) - a.maturity
+	if start < 1 {
+		start = 1
+	}
+	for height := start; height < len(bc.chain); height++ {
+		for _, t := range bc.chain[height].transactions {
+			if t.senderBlockchainAddress == MINING_SENDER && t.receiverBlockchainAddress == blockchainAddress {
+				a.addCoinbase(blockchainAddress, height, t.value)
+			}
+		}
+	}
+}
+
+// apply replays the transactions of b, failing when a sender skips or
+// reuses a nonce or spends more than its mature balance. Senders pay value
+// plus fee; the fees reach the miner through the coinbase. Untracked
+// addresses start empty.
+func (a *accounts) apply(b *Block, height int) *ChainError {
+	for i, t := range b.transactions {
+		if t.isUTXO() {
+			return chainErrorf(height, "transaction %d: %v: utxo transaction in an account ledger", i, ErrLedgerMismatch)
+		}
+		if t.senderBlockchainAddress != MINING_SENDER {
+			sender := t.senderBlockchainAddress
+			if t.nonce != a.nonces[sender] {
+				return chainErrorf(height, "transaction %d: nonce %d of %s, want %d", i, t.nonce, sender, a.nonces[sender])
+			}
+			cost, err := t.cost()
+			if err != nil {
+				return chainErrorf(height, "transaction %d: %v", i, err)
+			}
+			if mature := a.mature(sender, height); mature < cost {
+				return chainErrorf(height, "transaction %d: %s spends %s with a mature balance of %s", i, sender, cost, mature)
+			}
+			a.balances[sender] -= cost
+			a.nonces[sender]++
+		}
+		received, err := a.balances[t.receiverBlockchainAddress].Add(t.value)
+		if err != nil {
+			return chainErrorf(height, "transaction %d: %v", i, err)
+		}
+		a.balances[t.receiverBlockchainAddress] = received
+		if t.senderBlockchainAddress == MINING_SENDER && height > 0 {
+			a.addCoinbase(t.receiverBlockchainAddress, height, t.value)
+		}
+	}
+	return nil
+}
+
+// checkAccounts verifies b against the confirmed balances and nonces of its
+// senders. The caller must hold bc.mux.
+func (bc *BlockChain) checkAccounts(b *Block, height int) error {
+	a := newAccounts(bc.params.CoinbaseMaturity)
+	for _, t := range b.transactions {
+		for _, address := range []string{t.senderBlockchainAddress, t.receiverBlockchainAddress} {
+			if address == MINING_SENDER {
+				continue
+			}
+			bc.loadAccount(a, address)
+		}
+	}
+	if err := a.apply(b, height); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkLedger verifies b against the confirmed state of the ledger of the
+// chain. The caller must hold bc.mux.
+func (bc *BlockChain) checkLedger(b *Block, height int) error {
+	if bc.utxos != nil {
+		if err := bc.utxos.checkBlock(b, height); err != nil {
+			return err
+		}
+		return nil
+	}
+	return bc.checkAccounts(b, height)
+}
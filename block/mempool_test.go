@@ -0,0 +1,145 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/bc/utils"
+)
+
+// signTransaction signs t with key.
+func signTransaction(t *testing.T, tx *Transaction, key *ecdsa.PrivateKey) *utils.Signature {
+	t.Helper()
+	h := tx.SigningHash()
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &utils.Signature{R: r, S: s}
+}
+
+// coinbaseBlock returns a block at height holding only a coinbase of value
+// paying receiver.
+func coinbaseBlock(p *ChainParams, height int, receiver string, value utils.Amount) *Block {
+	return &Block{transactions: []*Transaction{NewTransaction(p.NetworkID, MINING_SENDER, receiver, value, 0, uint64(height))}}
+}
+
+func TestAccountsPruneMatureCoinbases(t *testing.T) {
+	p := RegtestParams()
+	p.CoinbaseMaturity = 10
+	a := newAccounts(p.CoinbaseMaturity)
+	for height := 1; height <= 1000; height++ {
+		if err := a.apply(coinbaseBlock(p, height, "miner", utils.COIN), height); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(a.coinbases["miner"]); n > p.CoinbaseMaturity {
+			t.Fatalf("height %d: %d coinbase credits kept, want at most %d", height, n, p.CoinbaseMaturity)
+		}
+	}
+	// the rewards of heights 992 to 1000 are still immature at 1001
+	if got, want := a.mature("miner", 1001), 991*utils.COIN; got != want {
+		t.Errorf("mature balance %s, want %s", got, want)
+	}
+}
+
+func TestAccountsApply(t *testing.T) {
+	p := RegtestParams()
+	send := func(sender, receiver string, value, fee utils.Amount, nonce uint64) *Transaction {
+		return NewTransaction(p.NetworkID, sender, receiver, value, fee, nonce)
+	}
+	block := func(height int, transactions ...*Transaction) *Block {
+		b := coinbaseBlock(p, height, "miner", p.Subsidy(height))
+		b.transactions = append(b.transactions, transactions...)
+		return b
+	}
+	tests := []struct {
+		name  string
+		block *Block
+		ok    bool
+	}{
+		{"send", block(1, send("alice", "bob", 3*utils.COIN, utils.COIN, 0)), true},
+		{"whole balance", block(1, send("alice", "bob", 9*utils.COIN, utils.COIN, 0)), true},
+		{"two in order", block(1, send("alice", "bob", utils.COIN, 0, 0), send("alice", "bob", utils.COIN, 0, 1)), true},
+		{"reused nonce", block(1, send("alice", "bob", utils.COIN, 0, 0), send("alice", "bob", utils.COIN, 0, 0)), false},
+		{"skipped nonce", block(1, send("alice", "bob", utils.COIN, 0, 1)), false},
+		{"overdraft", block(1, send("alice", "bob", 10*utils.COIN, 1, 0)), false},
+		{"overdraft across transactions", block(1, send("alice", "bob", 6*utils.COIN, 0, 0), send("alice", "bob", 5*utils.COIN, 0, 1)), false},
+		{"unfunded sender", block(1, send("bob", "alice", 1, 0, 0)), false},
+		{"cost overflow", block(1, send("alice", "bob", utils.MAX_AMOUNT, 1, 0)), false},
+		{"receiver overflow", block(1, send("alice", "whale", 1, 0, 0)), false},
+		{"utxo transaction", block(1, NewUTXOTransaction(p.NetworkID, []*TxInput{{}}, []*TxOutput{{Address: "bob", Value: 1}}, 0)), false},
+	}
+	for _, tt := range tests {
+		a := newAccounts(p.CoinbaseMaturity)
+		genesis := []*Transaction{
+			NewTransaction(p.NetworkID, MINING_SENDER, "alice", 10*utils.COIN, 0, GENESIS_ALLOCATION_NONCE),
+			NewTransaction(p.NetworkID, MINING_SENDER, "whale", utils.MAX_AMOUNT, 0, GENESIS_ALLOCATION_NONCE+1),
+		}
+		if err := a.apply(&Block{transactions: genesis}, 0); err != nil {
+			t.Fatal(err)
+		}
+		err := a.apply(tt.block, 1)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: apply error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+
+	a := newAccounts(p.CoinbaseMaturity)
+	if err := a.apply(&Block{transactions: []*Transaction{NewTransaction(p.NetworkID, MINING_SENDER, "alice", 10*utils.COIN, 0, GENESIS_ALLOCATION_NONCE)}}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.apply(block(1, send("alice", "bob", 3*utils.COIN, utils.COIN, 0)), 1); err != nil {
+		t.Fatal(err)
+	}
+	if a.balances["alice"] != 6*utils.COIN || a.balances["bob"] != 3*utils.COIN || a.nonces["alice"] != 1 {
+		t.Errorf("alice %s nonce %d, bob %s; want 6 nonce 1, 3", a.balances["alice"], a.nonces["alice"], a.balances["bob"])
+	}
+}
+
+func TestPoolCountsPendingOutflow(t *testing.T) {
+	p := RegtestParams()
+	key, alice := newTestKey(t, p)
+	_, bob := newTestKey(t, p)
+	p.Premine = []Allocation{{Address: alice, Amount: 10 * utils.COIN}}
+	bc, err := NewBlockChainWithParams(bob, 0, NewMemoryStore(), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Close()
+	add := func(value utils.Amount, nonce uint64) error {
+		tx := NewTransaction(p.NetworkID, alice, bob, value, utils.COIN, nonce)
+		return bc.AddTransaction(p.NetworkID, alice, bob, value, utils.COIN, nonce, &key.PublicKey, signTransaction(t, tx, key))
+	}
+
+	if err := add(5*utils.COIN, 0); err != nil {
+		t.Fatal(err)
+	}
+	// 6 of the 10 coins are spoken for by the pool
+	if err := add(4*utils.COIN, 1); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("spend over the pending outflow: %v, want %v", err, ErrInsufficientBalance)
+	}
+	if err := add(3*utils.COIN, 0); !errors.Is(err, ErrInvalidNonce) {
+		t.Fatalf("reused nonce: %v, want %v", err, ErrInvalidNonce)
+	}
+	if err := add(3*utils.COIN, 1); err != nil {
+		t.Fatal(err)
+	}
+	if spendable, _ := bc.SpendableBalance(alice); spendable != 0 {
+		t.Errorf("spendable %s, want 0", spendable)
+	}
+
+	if !bc.Mining() {
+		t.Fatal("mining failed")
+	}
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Errorf("pool holds %d transactions after mining, want 0", n)
+	}
+	if got := bc.CalculateTotal(alice); got != 0 {
+		t.Errorf("alice holds %s, want 0", got)
+	}
+	if got, want := bc.CalculateTotal(bob), 8*utils.COIN+p.Subsidy(1)+2*utils.COIN; got != want {
+		t.Errorf("bob holds %s, want %s", got, want)
+	}
+}
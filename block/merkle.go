@@ -0,0 +1,219 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ****************Merkle Related ****************//
+
+// The merkle tree of a block is built over the ids of its transactions. Each
+// parent is the SHA-256 of its two children concatenated; a level with an odd
+// number of nodes pairs its last node with itself. A block without
+// transactions has the zero root.
+
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+const (
+	MERKLE_LEFT  = "left"
+	MERKLE_RIGHT = "right"
+)
+
+// MerkleStep is one sibling on the path from a transaction to the root.
+// Position tells on which side of the running hash the sibling goes.
+type MerkleStep struct {
+	Hash     [32]byte
+	Position string
+}
+
+// MerkleProof shows that a transaction is included in a block.
+type MerkleProof struct {
+	TransactionID [32]byte
+	BlockHeight   int
+	BlockHash     [32]byte
+	MerkleRoot    [32]byte
+	Branch        []MerkleStep
+}
+
+func merkleParent(left, right [32]byte) [32]byte {
+	var pair [64]byte
+	copy(pair[:32], left[:])
+	copy(pair[32:], right[:])
+	return sha256.Sum256(pair[:])
+}
+
+// MerkleRoot returns the root of the tree over ids.
+func MerkleRoot(ids [][32]byte) [32]byte {
+	if len(ids) == 0 {
+		return [32]byte{}
+	}
+	level := ids
+	for len(level) > 1 {
+		level = nextMerkleLevel(level)
+	}
+	return level[0]
+}
+
+func nextMerkleLevel(level [][32]byte) [][32]byte {
+	next := make([][32]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		right := level[i]
+		if i+1 < len(level) {
+			right = level[i+1]
+		}
+		next = append(next, merkleParent(level[i], right))
+	}
+	return next
+}
+
+func transactionIDs(transactions []*Transaction) [][32]byte {
+	ids := make([][32]byte, len(transactions))
+	for i, t := range transactions {
+		ids[i] = t.ID()
+	}
+	return ids
+}
+
+func merkleRootOf(transactions []*Transaction) [32]byte {
+	return MerkleRoot(transactionIDs(transactions))
+}
+
+// merkleBranch returns the siblings on the path from ids[index] to the root.
+func merkleBranch(ids [][32]byte, index int) []MerkleStep {
+	branch := make([]MerkleStep, 0)
+	level := ids
+	for len(level) > 1 {
+		if index%2 == 0 {
+			sibling := level[index]
+			if index+1 < len(level) {
+				sibling = level[index+1]
+			}
+			branch = append(branch, MerkleStep{Hash: sibling, Position: MERKLE_RIGHT})
+		} else {
+			branch = append(branch, MerkleStep{Hash: level[index-1], Position: MERKLE_LEFT})
+		}
+		level = nextMerkleLevel(level)
+		index /= 2
+	}
+	return branch
+}
+
+// VerifyMerkleProof reports whether branch leads from id to root.
+func VerifyMerkleProof(id [32]byte, branch []MerkleStep, root [32]byte) bool {
+	hash := id
+	for _, step := range branch {
+		switch step.Position {
+		case MERKLE_LEFT:
+			hash = merkleParent(step.Hash, hash)
+		case MERKLE_RIGHT:
+			hash = merkleParent(hash, step.Hash)
+		default:
+			return false
+		}
+	}
+	return hash == root
+}
+
+// Verify checks the branch of p against its merkle root. Clients must still
+// check that the root belongs to a block header they trust.
+func (p *MerkleProof) Verify() bool {
+	return VerifyMerkleProof(p.TransactionID, p.Branch, p.MerkleRoot)
+}
+
+// TransactionProof builds the merkle proof of a confirmed transaction.
+func (bc *BlockChain) TransactionProof(id [32]byte) (*MerkleProof, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	height, ok := bc.transactionIndex[id]
+	if !ok {
+		return nil, ErrTransactionNotFound
+	}
+	b := bc.chain[height]
+	ids := transactionIDs(b.transactions)
+	for i := range ids {
+		if ids[i] == id {
+			return &MerkleProof{
+				TransactionID: id,
+				BlockHeight:   height,
+				BlockHash:     b.Hash(),
+				MerkleRoot:    b.header.merkleRoot,
+				Branch:        merkleBranch(ids, i),
+			}, nil
+		}
+	}
+	return nil, ErrTransactionNotFound
+}
+
+func (s MerkleStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Hash     string `json:"hash"`
+		Position string `json:"position"`
+	}{
+		Hash:     fmt.Sprintf("%x", s.Hash),
+		Position: s.Position,
+	})
+}
+
+func (s *MerkleStep) UnmarshalJSON(data []byte) error {
+	var hash string
+	v := &struct {
+		Hash     *string `json:"hash"`
+		Position *string `json:"position"`
+	}{
+		Hash:     &hash,
+		Position: &s.Position,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var err error
+	s.Hash, err = decodeHash("hash", hash)
+	return err
+}
+
+func (p *MerkleProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TransactionID string       `json:"transaction_id"`
+		BlockHeight   int          `json:"block_height"`
+		BlockHash     string       `json:"block_hash"`
+		MerkleRoot    string       `json:"merkle_root"`
+		Branch        []MerkleStep `json:"branch"`
+	}{
+		TransactionID: fmt.Sprintf("%x", p.TransactionID),
+		BlockHeight:   p.BlockHeight,
+		BlockHash:     fmt.Sprintf("%x", p.BlockHash),
+		MerkleRoot:    fmt.Sprintf("%x", p.MerkleRoot),
+		Branch:        p.Branch,
+	})
+}
+
+func (p *MerkleProof) UnmarshalJSON(data []byte) error {
+	var transactionID, blockHash, merkleRoot string
+	v := &struct {
+		TransactionID *string       `json:"transaction_id"`
+		BlockHeight   *int          `json:"block_height"`
+		BlockHash     *string       `json:"block_hash"`
+		MerkleRoot    *string       `json:"merkle_root"`
+		Branch        *[]MerkleStep `json:"branch"`
+	}{
+		TransactionID: &transactionID,
+		BlockHeight:   &p.BlockHeight,
+		BlockHash:     &blockHash,
+		MerkleRoot:    &merkleRoot,
+		Branch:        &p.Branch,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var err error
+	if p.TransactionID, err = decodeHash("transaction_id", transactionID); err != nil {
+		return err
+	}
+	if p.BlockHash, err = decodeHash("block_hash", blockHash); err != nil {
+		return err
+	}
+	p.MerkleRoot, err = decodeHash("merkle_root", merkleRoot)
+	return err
+}
@@ -0,0 +1,80 @@
+package block
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func merkleLeaves(n int) [][32]byte {
+	ids := make([][32]byte, n)
+	for i := range ids {
+		ids[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	return ids
+}
+
+func TestMerkleRoot(t *testing.T) {
+	ids := merkleLeaves(3)
+	tests := []struct {
+		name string
+		ids  [][32]byte
+		want [32]byte
+	}{
+		{"empty", nil, [32]byte{}},
+		{"single", ids[:1], ids[0]},
+		{"pair", ids[:2], merkleParent(ids[0], ids[1])},
+		{"odd", ids, merkleParent(merkleParent(ids[0], ids[1]), merkleParent(ids[2], ids[2]))},
+	}
+	for _, tt := range tests {
+		if got := MerkleRoot(tt.ids); got != tt.want {
+			t.Errorf("%s: MerkleRoot = %x, want %x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMerkleBranch(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 13} {
+		ids := merkleLeaves(n)
+		root := MerkleRoot(ids)
+		for i := range ids {
+			branch := merkleBranch(ids, i)
+			if !VerifyMerkleProof(ids[i], branch, root) {
+				t.Errorf("%d leaves: proof of leaf %d does not verify", n, i)
+			}
+			other := sha256.Sum256([]byte("other"))
+			if VerifyMerkleProof(other, branch, root) {
+				t.Errorf("%d leaves: proof of leaf %d verifies another id", n, i)
+			}
+		}
+	}
+}
+
+func TestVerifyMerkleProofRejectsTampering(t *testing.T) {
+	ids := merkleLeaves(7)
+	root := MerkleRoot(ids)
+	// the last leaf of an odd level is its own sibling
+	branch := merkleBranch(ids, 6)
+	if branch[0].Hash != ids[6] || branch[0].Position != MERKLE_RIGHT {
+		t.Fatalf("leaf 6 sibling = %x %s, want itself on the right", branch[0].Hash, branch[0].Position)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]MerkleStep) []MerkleStep
+	}{
+		{"flipped hash", func(b []MerkleStep) []MerkleStep { b[1].Hash[0] ^= 1; return b }},
+		{"swapped side", func(b []MerkleStep) []MerkleStep { b[0].Position = MERKLE_RIGHT; return b }},
+		{"unknown side", func(b []MerkleStep) []MerkleStep { b[0].Position = "up"; return b }},
+		{"missing step", func(b []MerkleStep) []MerkleStep { return b[:len(b)-1] }},
+		{"extra step", func(b []MerkleStep) []MerkleStep { return append(b, MerkleStep{Hash: root, Position: MERKLE_LEFT}) }},
+	}
+	for _, tt := range tests {
+		tampered := tt.tamper(append([]MerkleStep{}, merkleBranch(ids, 5)...))
+		if VerifyMerkleProof(ids[5], tampered, root) {
+			t.Errorf("%s: tampered proof verifies", tt.name)
+		}
+	}
+	if VerifyMerkleProof(ids[5], merkleBranch(ids, 5), [32]byte{}) {
+		t.Errorf("proof verifies against the wrong root")
+	}
+}
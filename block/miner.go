@@ -0,0 +1,141 @@
+package block
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ****************Miner Related ****************//
+
+// The proof of work search runs on a snapshot of the chain tip and pool
+// without holding bc.mux. Its nonce space is striped across one worker per
+// GOMAXPROCS: worker i tries i, i+n, i+2n, ... The search stops when a
+// worker finds a nonce, when the tip changes under it, or when the chain is
+// closed.
+
+const MINING_CANCEL_CHECK_HASHES = 1024 // hashes between context checks
+
+var ErrMiningInProgress = errors.New("mining already in progress")
+
+// miner tracks the running search and the hashrate of the last one.
+type miner struct {
+	hashes   uint64 // hashes of the running search, updated atomically
+	mux      sync.Mutex
+	cancel   context.CancelFunc
+	started  time.Time
+	workers  int
+	hashRate float64
+}
+
+type MiningStatus struct {
+	Mining   bool    `json:"mining"`
+	Workers  int     `json:"workers"`
+	HashRate float64 `json:"hash_rate"`
+}
+
+// begin registers a search on a context derived from parent. It fails when
+// another search is running.
+func (m *miner) begin(parent context.Context, workers int) (context.Context, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.cancel != nil {
+		return nil, ErrMiningInProgress
+	}
+	ctx, cancel := context.WithCancel(parent)
+	m.cancel = cancel
+	m.started = time.Now()
+	m.workers = workers
+	atomic.StoreUint64(&m.hashes, 0)
+	return ctx, nil
+}
+
+// end closes the running search and records its hashrate.
+func (m *miner) end() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.cancel == nil {
+		return
+	}
+	m.cancel()
+	m.cancel = nil
+	if elapsed := time.Since(m.started).Seconds(); elapsed > 0 {
+		m.hashRate = float64(atomic.LoadUint64(&m.hashes)) / elapsed
+	}
+}
+
+// abort cancels the running search, if any.
+func (m *miner) abort() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+	}
+}
+
+func (m *miner) status() *MiningStatus {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	s := &MiningStatus{Mining: m.cancel != nil, Workers: m.workers, HashRate: m.hashRate}
+	if s.Mining {
+		if elapsed := time.Since(m.started).Seconds(); elapsed > 0 {
+			s.HashRate = float64(atomic.LoadUint64(&m.hashes)) / elapsed
+		}
+	}
+	return s
+}
+
+// ProofOfWork searches the nonce that makes header meet its target on
+// GOMAXPROCS workers. It returns ctx.Err() when ctx is done first.
+func (bc *BlockChain) ProofOfWork(ctx context.Context, header *BlockHeader) (int, error) {
+	return proofOfWork(ctx, header, bc.params.powLimit(), runtime.GOMAXPROCS(0), &bc.miner.hashes)
+}
+
+func proofOfWork(ctx context.Context, header *BlockHeader, powLimit *big.Int, workers int, hashes *uint64) (int, error) {
+	target, ok := targetBytes(header.bits, powLimit)
+	if !ok {
+		return 0, fmt.Errorf("invalid bits %08x", header.bits)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found := make(chan int, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(start int) {
+			defer wg.Done()
+			encoded := header.Encode()
+			n := 0
+			for nonce := start; ; nonce += workers {
+				setEncodedNonce(encoded, nonce)
+				hash := sha256.Sum256(encoded)
+				if meetsTarget(&hash, &target) {
+					found <- nonce
+					return
+				}
+				if n++; n == MINING_CANCEL_CHECK_HASHES {
+					atomic.AddUint64(hashes, uint64(n))
+					n = 0
+					if ctx.Err() != nil {
+						return
+					}
+				}
+			}
+		}(i)
+	}
+	select {
+	case nonce := <-found:
+		cancel()
+		wg.Wait()
+		return nonce, nil
+	case <-ctx.Done():
+		wg.Wait()
+		return 0, ctx.Err()
+	}
+}
@@ -0,0 +1,74 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bc/utils"
+)
+
+// ****************Network Related ****************//
+
+// Every transaction and block header commits to the network id of the chain
+// params, and every address starts with the address version of the network.
+// A transaction signed for testnet therefore cannot be replayed on mainnet,
+// and a wallet can tell from an address alone which network it belongs to.
+
+var (
+	ErrChainIDMismatch = errors.New("chain id does not match the network")
+	ErrAddressNetwork  = errors.New("address belongs to another network")
+)
+
+// CheckAddress reports whether address is well formed and of the network of
+// p.
+func (p *ChainParams) CheckAddress(address string) error {
+	version, err := utils.AddressVersion(address)
+	if err != nil {
+		return fmt.Errorf("%w %q", err, address)
+	}
+	if version != p.AddressVersion {
+		return fmt.Errorf("%w: %s has version %#02x, %s uses %#02x", ErrAddressNetwork, address, version, p.Name, p.AddressVersion)
+	}
+	return nil
+}
+
+// checkNetwork reports whether t was signed for the network of p and only
+// names addresses of that network.
+func (p *ChainParams) checkNetwork(t *Transaction) error {
+	if t.chainID != p.NetworkID {
+		return fmt.Errorf("%w: transaction for chain %d, %s is %d", ErrChainIDMismatch, t.chainID, p.Name, p.NetworkID)
+	}
+	if t.isUTXO() {
+		for _, out := range t.outputs {
+			if err := p.CheckAddress(out.Address); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if t.senderBlockchainAddress != MINING_SENDER {
+		if err := p.CheckAddress(t.senderBlockchainAddress); err != nil {
+			return err
+		}
+	}
+	return p.CheckAddress(t.receiverBlockchainAddress)
+}
+
+// CheckChainID reports whether chainID is the network id of the chain.
+func (bc *BlockChain) CheckChainID(chainID uint32) error {
+	if chainID != bc.params.NetworkID {
+		return fmt.Errorf("%w: chain %d, %s is %d", ErrChainIDMismatch, chainID, bc.params.Name, bc.params.NetworkID)
+	}
+	return nil
+}
+
+// CheckAddress reports whether address is well formed and of the network of
+// the chain.
+func (bc *BlockChain) CheckAddress(address string) error {
+	return bc.params.CheckAddress(address)
+}
+
+// ChainID is the network id b was mined for.
+func (b *Block) ChainID() uint32 {
+	return b.header.chainID
+}
@@ -0,0 +1,128 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ****************Orphan Block Related ****************//
+
+// An announced block whose parent is unknown waits in the orphan pool while
+// its parent is requested from the peer that sent it, walking back until a
+// block joins the chain; the waiting descendants are then connected in
+// order. Only orphans whose header carries valid proof of work are kept, so
+// that filling the pool costs real work. The pool holds at most
+// MAX_ORPHAN_BLOCKS blocks for at most ORPHAN_BLOCK_TTL_SEC; when it is full
+// the oldest orphan makes room.
+
+const (
+	MAX_ORPHAN_BLOCKS    = 100
+	ORPHAN_BLOCK_TTL_SEC = 600
+	NODE_PORT_HEADER     = "X-Blockchain-Port"
+)
+
+type orphanBlock struct {
+	block    *Block
+	peer     string
+	received time.Time
+}
+
+// pruneOrphans forgets the orphans older than ORPHAN_BLOCK_TTL_SEC. The
+// caller must hold bc.mux.
+func (bc *BlockChain) pruneOrphans() {
+	for hash, o := range bc.orphans {
+		if time.Since(o.received) > ORPHAN_BLOCK_TTL_SEC*time.Second {
+			delete(bc.orphans, hash)
+		}
+	}
+}
+
+// evictOldestOrphan forgets the orphan received first. The caller must hold
+// bc.mux.
+func (bc *BlockChain) evictOldestOrphan() {
+	var oldest [32]byte
+	var received time.Time
+	for hash, o := range bc.orphans {
+		if received.IsZero() || o.received.Before(received) {
+			oldest, received = hash, o.received
+		}
+	}
+	delete(bc.orphans, oldest)
+}
+
+// addOrphan keeps b, announced by peer, until its parent arrives, and
+// reports whether the parent must be requested. It fails when the header of
+// b does not pass checkHeader. The caller must hold bc.mux.
+func (bc *BlockChain) addOrphan(b *Block, hash [32]byte, peer string) (request bool, err error) {
+	if err := checkHeader(&b.header, bc.params); err != nil {
+		return false, fmt.Errorf("orphan %x: %w", hash, err)
+	}
+	bc.pruneOrphans()
+	if _, dup := bc.orphans[hash]; dup {
+		return false, nil
+	}
+	if len(bc.orphans) >= MAX_ORPHAN_BLOCKS {
+		bc.evictOldestOrphan()
+	}
+	if bc.orphans == nil {
+		bc.orphans = make(map[[32]byte]*orphanBlock)
+	}
+	bc.orphans[hash] = &orphanBlock{block: b, peer: peer, received: time.Now()}
+	_, waiting := bc.orphans[b.header.previousHash]
+	return !waiting, nil
+}
+
+// connectOrphans appends the orphans descending from the tip, in order, and
+// returns them. An orphan failing validation is dropped. The caller must
+// hold bc.mux.
+func (bc *BlockChain) connectOrphans() []*Block {
+	bc.pruneOrphans()
+	var connected []*Block
+	for {
+		tip := bc.LastBlock().Hash()
+		var next *Block
+		for hash, o := range bc.orphans {
+			if o.block.header.previousHash == tip {
+				next = o.block
+				delete(bc.orphans, hash)
+				break
+			}
+		}
+		if next == nil {
+			return connected
+		}
+		if err := bc.acceptBlock(next); err != nil {
+			log.Printf("ERROR: Orphan block %v", err)
+			continue
+		}
+		connected = append(connected, next)
+	}
+}
+
+// requestBlock asks peer for the block with hash and hands it on as if peer
+// had announced it.
+func (bc *BlockChain) requestBlock(peer string, hash [32]byte) {
+	resp, err := neighborClient.Get(fmt.Sprintf("http://%s/blocks/hash/%x", peer, hash))
+	if err != nil {
+		log.Printf("ERROR: Request block from %s %v", peer, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("ERROR: Request block %x from %s: %s", hash, peer, resp.Status)
+		return
+	}
+	var b Block
+	if err := json.NewDecoder(resp.Body).Decode(&b); err != nil {
+		log.Printf("ERROR: Request block from %s %v", peer, err)
+		return
+	}
+	if b.Hash() != hash {
+		log.Printf("ERROR: Request block %x from %s: got %x", hash, peer, b.Hash())
+		return
+	}
+	bc.ReceiveBlock(&b, peer)
+}
@@ -0,0 +1,94 @@
+package block
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+// orphanHeader returns a block of p on top of the unknown parent named by
+// seed, mined when mined is set and failing its target otherwise.
+func orphanHeader(p *ChainParams, seed int, mined bool) *Block {
+	b := NewBlock(0, sha256.Sum256([]byte{byte(seed), byte(seed >> 8)}), nil)
+	b.header.chainID = p.NetworkID
+	b.header.bits = uint32(p.GenesisBits)
+	for validProof(&b.header, p) != mined {
+		b.header.nonce++
+	}
+	return b
+}
+
+func TestAddOrphanChecksHeader(t *testing.T) {
+	p := MainnetParams()
+	bc := newTestChain(t, p)
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	tests := []struct {
+		name  string
+		block func() *Block
+	}{
+		{"unmined", func() *Block { return orphanHeader(p, 0, false) }},
+		{"other chain", func() *Block {
+			other := MainnetParams()
+			other.NetworkID++
+			return orphanHeader(other, 0, true)
+		}},
+		{"above pow limit", func() *Block {
+			b := orphanHeader(p, 0, false)
+			b.header.bits = 0x2100ffff
+			return b
+		}},
+		{"far future", func() *Block {
+			b := orphanHeader(p, 0, false)
+			b.header.timeStamp = time.Now().Add(time.Hour).UnixNano()
+			for !validProof(&b.header, p) {
+				b.header.nonce++
+			}
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		b := tt.block()
+		if _, err := bc.addOrphan(b, b.Hash(), "peer"); err == nil {
+			t.Errorf("%s: orphan admitted", tt.name)
+		}
+	}
+	if len(bc.orphans) != 0 {
+		t.Fatalf("pool holds %d orphans, want 0", len(bc.orphans))
+	}
+
+	b := orphanHeader(p, 0, true)
+	request, err := bc.addOrphan(b, b.Hash(), "peer")
+	if err != nil || !request {
+		t.Fatalf("mined orphan: request %v, err %v", request, err)
+	}
+}
+
+func TestAddOrphanEvictsOldest(t *testing.T) {
+	p := RegtestParams()
+	bc := newTestChain(t, p)
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+
+	var first [32]byte
+	for i := 0; i <= MAX_ORPHAN_BLOCKS; i++ {
+		b := orphanHeader(p, i, true)
+		if i == 0 {
+			first = b.Hash()
+		}
+		if _, err := bc.addOrphan(b, b.Hash(), "peer"); err != nil {
+			t.Fatalf("orphan %d: %v", i, err)
+		}
+		if i == 0 {
+			// make the first orphan clearly the oldest
+			bc.orphans[first].received = time.Now().Add(-time.Minute)
+		}
+	}
+	if len(bc.orphans) != MAX_ORPHAN_BLOCKS {
+		t.Fatalf("pool holds %d orphans, want %d", len(bc.orphans), MAX_ORPHAN_BLOCKS)
+	}
+	if _, ok := bc.orphans[first]; ok {
+		t.Errorf("oldest orphan was not evicted")
+	}
+}
@@ -0,0 +1,257 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/bc/utils"
+)
+
+// ****************Chain Params Related ****************//
+
+// ChainParams fixes the genesis block and the consensus rules of a network.
+// Nodes only agree on a chain when they run the same parameters: the genesis
+// block is built from them, so its hash already tells networks apart. The
+// built-in presets are mainnet, testnet and regtest, a network with trivial
+// proof of work and fast maturity for integration tests. LoadChainParams
+// reads the same fields from a JSON file.
+
+const (
+	NETWORK_MAINNET = "mainnet"
+	NETWORK_TESTNET = "testnet"
+	NETWORK_REGTEST = "regtest"
+)
+
+// Allocation credits Amount to Address in the genesis block.
+type Allocation struct {
+	Address string       `json:"address"`
+	Amount  utils.Amount `json:"amount"`
+}
+
+// CompactBits is a target in compact form, written in JSON as 8 hex digits
+// like block headers do.
+type CompactBits uint32
+
+func (b CompactBits) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%08x", uint32(b)))
+}
+
+func (b *CompactBits) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 8 {
+		return fmt.Errorf("invalid bits %q", s)
+	}
+	*b = CompactBits(n)
+	return nil
+}
+
+type ChainParams struct {
+	Name string `json:"name"`
+	// NetworkID is signed into every transaction and block header;
+	// AddressVersion is the first byte of every address.
+	NetworkID      uint32 `json:"network_id"`
+	AddressVersion byte   `json:"address_version"`
+	Ledger         string `json:"ledger"`
+
+	// GenesisTimestamp is in unix nanoseconds, like block timestamps.
+	GenesisTimestamp int64        `json:"genesis_timestamp"`
+	Premine          []Allocation `json:"premine"`
+
+	GenesisBits  CompactBits `json:"genesis_bits"`
+	PowLimitBits CompactBits `json:"pow_limit_bits"`
+	// DifficultyAdjustmentInterval is the number of blocks between
+	// retargets; 0 keeps GenesisBits forever.
+	DifficultyAdjustmentInterval int `json:"difficulty_adjustment_interval"`
+	TargetBlockTimeSec           int `json:"target_block_time_sec"`
+
+	InitialReward    utils.Amount `json:"initial_reward"`
+	HalvingInterval  int          `json:"halving_interval"`
+	CoinbaseMaturity int          `json:"coinbase_maturity"`
+
+	PortRangeStart uint16 `json:"port_range_start"`
+	PortRangeEnd   uint16 `json:"port_range_end"`
+}
+
+// MainnetParams returns the parameters of the main network.
+func MainnetParams() *ChainParams {
+	return &ChainParams{
+		Name:                         NETWORK_MAINNET,
+		NetworkID:                    1,
+		AddressVersion:               0x00,
+		Ledger:                       LEDGER_ACCOUNT,
+		GenesisTimestamp:             1735689600000000000, // 2025-01-01 UTC
+		Premine:                      []Allocation{},
+		GenesisBits:                  0x1f0fffff, // three leading zero hex digits
+		PowLimitBits:                 0x200fffff, // one leading zero hex digit
+		DifficultyAdjustmentInterval: 10,
+		TargetBlockTimeSec:           30,
+		InitialReward:                1 * utils.COIN,
+		HalvingInterval:              210000,
+		CoinbaseMaturity:             10,
+		PortRangeStart:               5000,
+		PortRangeEnd:                 5003,
+	}
+}
+
+// TestnetParams returns the parameters of the public test network, which
+// starts at the easiest target.
+func TestnetParams() *ChainParams {
+	p := MainnetParams()
+	p.Name = NETWORK_TESTNET
+	p.NetworkID = 2
+	p.AddressVersion = 0x6f
+	p.GenesisTimestamp = 1735689600000000001
+	p.GenesisBits = p.PowLimitBits
+	p.PortRangeStart = 6000
+	p.PortRangeEnd = 6003
+	return p
+}
+
+// RegtestParams returns the parameters of a private network for tests:
+// nearly any hash meets the target, which never changes, and rewards mature
+// after two blocks.
+func RegtestParams() *ChainParams {
+	p := MainnetParams()
+	p.Name = NETWORK_REGTEST
+	p.NetworkID = 3
+	p.AddressVersion = 0x7a
+	p.GenesisTimestamp = 1735689600000000002
+	p.GenesisBits = 0x2100ffff
+	p.PowLimitBits = 0x2100ffff
+	p.DifficultyAdjustmentInterval = 0
+	p.TargetBlockTimeSec = 1
+	p.HalvingInterval = 150
+	p.CoinbaseMaturity = 2
+	p.PortRangeStart = 7000
+	p.PortRangeEnd = 7003
+	return p
+}
+
+// ParamsForNetwork returns the preset named name.
+func ParamsForNetwork(name string) (*ChainParams, error) {
+	switch name {
+	case NETWORK_MAINNET:
+		return MainnetParams(), nil
+	case NETWORK_TESTNET:
+		return TestnetParams(), nil
+	case NETWORK_REGTEST:
+		return RegtestParams(), nil
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+// LoadChainParams reads parameters from the JSON file at path. Fields the
+// file leaves out keep their mainnet values.
+func LoadChainParams(path string) (*ChainParams, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := MainnetParams()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("chain params %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("chain params %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Validate reports the first parameter no chain could be built on.
+func (p *ChainParams) Validate() error {
+	switch {
+	case p.Name == "":
+		return errors.New("name is empty")
+	case p.NetworkID == 0:
+		return errors.New("network id must not be zero")
+	case p.Ledger != LEDGER_ACCOUNT && p.Ledger != LEDGER_UTXO:
+		return fmt.Errorf("unknown ledger %q", p.Ledger)
+	case p.powLimit().Sign() <= 0, p.powLimit().BitLen() > 256:
+		return fmt.Errorf("invalid pow limit bits %08x", uint32(p.PowLimitBits))
+	}
+	if _, ok := targetBytes(uint32(p.GenesisBits), p.powLimit()); !ok {
+		return fmt.Errorf("genesis bits %08x exceed the pow limit", uint32(p.GenesisBits))
+	}
+	switch {
+	case p.DifficultyAdjustmentInterval < 0:
+		return errors.New("difficulty adjustment interval is negative")
+	case p.TargetBlockTimeSec <= 0:
+		return errors.New("target block time must be positive")
+	case p.InitialReward < 0:
+		return errors.New("initial reward is negative")
+	case p.HalvingInterval <= 0:
+		return errors.New("halving interval must be positive")
+	case p.CoinbaseMaturity < 0:
+		return errors.New("coinbase maturity is negative")
+	case p.PortRangeStart == 0 || p.PortRangeEnd < p.PortRangeStart:
+		return fmt.Errorf("invalid port range %d-%d", p.PortRangeStart, p.PortRangeEnd)
+	}
+	// every amount the chain can create must fit in an Amount
+	var supply utils.Amount
+	for subsidy := p.InitialReward; subsidy > 0; subsidy >>= 1 {
+		era, err := subsidy.Mul(utils.Amount(p.HalvingInterval))
+		if err == nil {
+			supply, err = supply.Add(era)
+		}
+		if err != nil {
+			return fmt.Errorf("reward schedule: %w", err)
+		}
+	}
+	for _, a := range p.Premine {
+		if a.Amount <= 0 {
+			return fmt.Errorf("invalid premine of %s to %q", a.Amount, a.Address)
+		}
+		if err := p.CheckAddress(a.Address); err != nil {
+			return fmt.Errorf("premine: %w", err)
+		}
+		var err error
+		if supply, err = supply.Add(a.Amount); err != nil {
+			return fmt.Errorf("premine: %w", err)
+		}
+	}
+	return nil
+}
+
+func (p *ChainParams) powLimit() *big.Int {
+	return CompactToBig(uint32(p.PowLimitBits))
+}
+
+// GENESIS_ALLOCATION_NONCE is the nonce of the first genesis allocation.
+// Coinbases carry the height of their block as nonce, which never reaches
+// this range, so no allocation shares an id with a coinbase.
+const GENESIS_ALLOCATION_NONCE uint64 = 1 << 63
+
+// Genesis builds the genesis block: the premine allocations paid like
+// coinbase rewards, numbered from GENESIS_ALLOCATION_NONCE, stamped
+// GenesisTimestamp with target GenesisBits. Having no parent, it commits to
+// the ledger in place of a previous hash, so that account and UTXO chains of
+// one network never share a genesis. It needs no proof of work.
+func (p *ChainParams) Genesis() *Block {
+	transactions := make([]*Transaction, len(p.Premine))
+	for i, a := range p.Premine {
+		transactions[i] = NewTransaction(p.NetworkID, MINING_SENDER, a.Address, a.Amount, 0, GENESIS_ALLOCATION_NONCE+uint64(i))
+	}
+	b := &Block{transactions: transactions}
+	b.header.chainID = p.NetworkID
+	b.header.timeStamp = p.GenesisTimestamp
+	b.header.bits = uint32(p.GenesisBits)
+	b.header.previousHash = sha256.Sum256([]byte(p.Ledger))
+	b.header.merkleRoot = merkleRootOf(transactions)
+	return b
+}
+
+// Params returns a copy of the parameters bc runs with.
+func (bc *BlockChain) Params() *ChainParams {
+	p := *bc.params
+	p.Premine = append([]Allocation{}, bc.params.Premine...)
+	return &p
+}
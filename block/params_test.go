@@ -0,0 +1,53 @@
+package block
+
+import (
+	"testing"
+
+	"github.com/bc/utils"
+)
+
+func TestGenesisAllocationsDoNotCollideWithCoinbases(t *testing.T) {
+	for _, ledger := range []string{LEDGER_ACCOUNT, LEDGER_UTXO} {
+		p := RegtestParams()
+		p.Ledger = ledger
+		_, other := newTestKey(t, p)
+		_, miner := newTestKey(t, p)
+		// allocation 1 pays exactly what the coinbase of block 1 pays
+		p.Premine = []Allocation{{Address: other, Amount: 1}, {Address: miner, Amount: p.InitialReward}}
+		bc, err := NewBlockChainWithParams(miner, 0, NewMemoryStore(), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bc.Mining() {
+			t.Fatalf("%s: mining failed", ledger)
+		}
+		want := 2 * p.InitialReward
+		if got := bc.CalculateTotal(miner); got != want {
+			t.Errorf("%s: balance %s, want %s", ledger, got, want)
+		}
+		if ledger == LEDGER_UTXO {
+			outputs, err := bc.UnspentOutputs(miner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var total utils.Amount
+			for _, u := range outputs {
+				total += u.Value
+			}
+			if len(outputs) != 2 || total != want {
+				t.Errorf("%s: %d unspent outputs worth %s, want 2 worth %s", ledger, len(outputs), total, want)
+			}
+		}
+		allocation, coinbase := bc.chain[0].transactions[1], bc.chain[1].transactions[0]
+		if allocation.ID() == coinbase.ID() {
+			t.Errorf("%s: allocation and coinbase share id %x", ledger, coinbase.ID())
+		}
+		if proof, err := bc.TransactionProof(allocation.ID()); err != nil || proof.BlockHeight != 0 {
+			t.Errorf("%s: allocation proof %v, %v, want height 0", ledger, proof, err)
+		}
+		if err := bc.Validate(); err != nil {
+			t.Errorf("%s: %v", ledger, err)
+		}
+		bc.Close()
+	}
+}
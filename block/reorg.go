@@ -0,0 +1,107 @@
+package block
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ****************Reorg Related ****************//
+
+// A reorg replaces the blocks above the fork point with a competing branch.
+// The transactions of the orphaned blocks go back to the pool ahead of the
+// waiting ones, keeping each sender's nonce order, and the pool is then
+// checked against the new branch: a transaction the branch already includes
+// is reconfirmed, one it invalidates is dropped. Every reorg is logged and
+// the last MAX_REORG_EVENTS are kept for GET /reorgs.
+
+const MAX_REORG_EVENTS = 100
+
+type ReorgEvent struct {
+	Time        int64    `json:"time"`
+	ForkHeight  int      `json:"fork_height"`
+	Depth       int      `json:"depth"`
+	OldTip      string   `json:"old_tip"`
+	NewTip      string   `json:"new_tip"`
+	NewHeight   int      `json:"new_height"`
+	Restored    []string `json:"restored"`
+	Reconfirmed []string `json:"reconfirmed"`
+	Dropped     []string `json:"dropped"`
+}
+
+// orphanedTransactions lists the non-coinbase transactions of blocks in
+// order.
+func orphanedTransactions(blocks []*Block) []*Transaction {
+	var orphaned []*Transaction
+	for _, b := range blocks {
+		for _, t := range b.transactions {
+			if t.senderBlockchainAddress != MINING_SENDER {
+				orphaned = append(orphaned, t)
+			}
+		}
+	}
+	return orphaned
+}
+
+// restoreTransactions puts orphaned in front of the pool, skipping the ones
+// already waiting there. The caller must hold bc.mux.
+func (bc *BlockChain) restoreTransactions(orphaned []*Transaction) {
+	waiting := make(map[[32]byte]bool)
+	for _, t := range bc.transactionPool {
+		waiting[t.ID()] = true
+	}
+	transactionPool := make([]*Transaction, 0, len(orphaned)+len(bc.transactionPool))
+	for _, t := range orphaned {
+		if !waiting[t.ID()] {
+			transactionPool = append(transactionPool, t)
+		}
+	}
+	bc.transactionPool = append(transactionPool, bc.transactionPool...)
+}
+
+// recordReorg keeps the event of replacing the blocks above fork-1 with the
+// current chain, sorting the transactions of the orphaned blocks by where
+// the reorg left them. The caller must hold bc.mux.
+func (bc *BlockChain) recordReorg(fork int, orphanedBlocks []*Block) {
+	e := &ReorgEvent{
+		Time:        time.Now().UnixNano(),
+		ForkHeight:  fork - 1,
+		Depth:       len(orphanedBlocks),
+		OldTip:      fmt.Sprintf("%x", orphanedBlocks[len(orphanedBlocks)-1].Hash()),
+		NewTip:      fmt.Sprintf("%x", bc.chain[len(bc.chain)-1].Hash()),
+		NewHeight:   len(bc.chain) - 1,
+		Restored:    make([]string, 0),
+		Reconfirmed: make([]string, 0),
+		Dropped:     make([]string, 0),
+	}
+	pooled := make(map[[32]byte]bool)
+	for _, t := range bc.transactionPool {
+		pooled[t.ID()] = true
+	}
+	for _, t := range orphanedTransactions(orphanedBlocks) {
+		id := t.ID()
+		switch _, confirmed := bc.transactionIndex[id]; {
+		case confirmed:
+			e.Reconfirmed = append(e.Reconfirmed, fmt.Sprintf("%x", id))
+		case pooled[id]:
+			e.Restored = append(e.Restored, fmt.Sprintf("%x", id))
+		default:
+			e.Dropped = append(e.Dropped, fmt.Sprintf("%x", id))
+		}
+	}
+	if len(bc.reorgs) == MAX_REORG_EVENTS {
+		bc.reorgs = bc.reorgs[1:]
+	}
+	bc.reorgs = append(bc.reorgs, e)
+	log.Printf("action=reorg, fork_height=%d, depth=%d, restored=%d, reconfirmed=%d, dropped=%d",
+		e.ForkHeight, e.Depth, len(e.Restored), len(e.Reconfirmed), len(e.Dropped))
+}
+
+// Reorgs returns the recorded reorg events, oldest first.
+func (bc *BlockChain) Reorgs() []*ReorgEvent {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	reorgs := make([]*ReorgEvent, len(bc.reorgs))
+	copy(reorgs, bc.reorgs)
+	return reorgs
+}
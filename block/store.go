@@ -0,0 +1,348 @@
+package block
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists the blocks and the pending transactions of a BlockChain so
+// that a node can stop and resume from its last block.
+type Store interface {
+	// Blocks returns every stored block ordered by height.
+	Blocks() ([]*Block, error)
+	// AppendBlock stores b on top of the current tip.
+	AppendBlock(b *Block) error
+	// Truncate drops every block at or above height.
+	Truncate(height int) error
+	// TransactionPool returns the last saved transaction pool.
+	TransactionPool() ([]*Transaction, error)
+	// SaveTransactionPool replaces the saved transaction pool.
+	SaveTransactionPool(transactions []*Transaction) error
+	Close() error
+}
+
+// *****************Memory Store*****************//
+
+// MemoryStore keeps everything in memory and loses it when the process exits.
+type MemoryStore struct {
+	mux             sync.Mutex
+	blocks          []*Block
+	transactionPool []*Transaction
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (ms *MemoryStore) Blocks() ([]*Block, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	blocks := make([]*Block, len(ms.blocks))
+	copy(blocks, ms.blocks)
+	return blocks, nil
+}
+
+func (ms *MemoryStore) AppendBlock(b *Block) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.blocks = append(ms.blocks, b)
+	return nil
+}
+
+func (ms *MemoryStore) Truncate(height int) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	if height < 0 {
+		return fmt.Errorf("store: invalid height %d", height)
+	}
+	if height < len(ms.blocks) {
+		ms.blocks = ms.blocks[:height]
+	}
+	return nil
+}
+
+func (ms *MemoryStore) TransactionPool() ([]*Transaction, error) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	transactions := make([]*Transaction, len(ms.transactionPool))
+	copy(transactions, ms.transactionPool)
+	return transactions, nil
+}
+
+func (ms *MemoryStore) SaveTransactionPool(transactions []*Transaction) error {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+	ms.transactionPool = make([]*Transaction, len(transactions))
+	copy(ms.transactionPool, transactions)
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// *****************File Store*****************//
+
+const (
+	blockLogFile        = "blocks.log"
+	blockIndexFile      = "blocks.idx"
+	transactionPoolFile = "mempool.json"
+	// every block log record starts with its length as a big endian uint32
+	recordHeaderSize = 4
+	// every index entry is the log offset of a block as a big endian uint64
+	indexEntrySize = 8
+)
+
+// FileStore keeps blocks in an append-only log next to an index holding the
+// log offset of every block, so a block can be found by height without
+// scanning the log. The transaction pool is rewritten as a whole on save.
+type FileStore struct {
+	mux     sync.Mutex
+	dir     string
+	log     *os.File
+	index   *os.File
+	offsets []int64
+	size    int64
+}
+
+// NewFileStore opens the store in dir, creating it if needed. A block that
+// made it into the log but not into the index, for instance because the
+// process died in between, is indexed again; a partly written record at the
+// end of the log is discarded.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(filepath.Join(dir, blockLogFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	indexFile, err := os.OpenFile(filepath.Join(dir, blockIndexFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	fs := &FileStore{dir: dir, log: logFile, index: indexFile}
+	if err := fs.recover(); err != nil {
+		fs.Close()
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) recover() error {
+	info, err := fs.log.Stat()
+	if err != nil {
+		return err
+	}
+	fs.size = info.Size()
+
+	raw, err := io.ReadAll(io.NewSectionReader(fs.index, 0, 1<<62))
+	if err != nil {
+		return err
+	}
+	// keep the entries that point at a complete record, in order
+	end := int64(0)
+	for i := 0; i+indexEntrySize <= len(raw); i += indexEntrySize {
+		offset := int64(binary.BigEndian.Uint64(raw[i:]))
+		if offset != end {
+			break
+		}
+		length, err := fs.recordLength(offset)
+		if err != nil {
+			break
+		}
+		fs.offsets = append(fs.offsets, offset)
+		end = offset + recordHeaderSize + length
+	}
+	// index the records written after the last index entry
+	for end < fs.size {
+		length, err := fs.recordLength(end)
+		if err != nil {
+			break
+		}
+		fs.offsets = append(fs.offsets, end)
+		end += recordHeaderSize + length
+	}
+	if end != fs.size {
+		if err := fs.log.Truncate(end); err != nil {
+			return err
+		}
+		fs.size = end
+	}
+	return fs.writeIndex()
+}
+
+// recordLength returns the payload length of the record at offset, failing
+// when the record does not fit in the log.
+func (fs *FileStore) recordLength(offset int64) (int64, error) {
+	var header [recordHeaderSize]byte
+	if offset+recordHeaderSize > fs.size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if _, err := fs.log.ReadAt(header[:], offset); err != nil {
+		return 0, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[:]))
+	if offset+recordHeaderSize+length > fs.size {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return length, nil
+}
+
+func (fs *FileStore) writeIndex() error {
+	raw := make([]byte, len(fs.offsets)*indexEntrySize)
+	for i, offset := range fs.offsets {
+		binary.BigEndian.PutUint64(raw[i*indexEntrySize:], uint64(offset))
+	}
+	if err := fs.index.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := fs.index.WriteAt(raw, 0); err != nil {
+		return err
+	}
+	return fs.index.Sync()
+}
+
+func (fs *FileStore) Blocks() ([]*Block, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	blocks := make([]*Block, 0, len(fs.offsets))
+	for height := range fs.offsets {
+		b, err := fs.readBlock(height)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func (fs *FileStore) readBlock(height int) (*Block, error) {
+	offset := fs.offsets[height]
+	length, err := fs.recordLength(offset)
+	if err != nil {
+		return nil, err
+	}
+	m := make([]byte, length)
+	if _, err := fs.log.ReadAt(m, offset+recordHeaderSize); err != nil {
+		return nil, err
+	}
+	b := new(Block)
+	if err := json.Unmarshal(m, b); err != nil {
+		return nil, fmt.Errorf("store: block %d: %w", height, err)
+	}
+	return b, nil
+}
+
+func (fs *FileStore) AppendBlock(b *Block) error {
+	m, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	record := make([]byte, recordHeaderSize+len(m))
+	binary.BigEndian.PutUint32(record, uint32(len(m)))
+	copy(record[recordHeaderSize:], m)
+	if _, err := fs.log.WriteAt(record, fs.size); err != nil {
+		return err
+	}
+	if err := fs.log.Sync(); err != nil {
+		return err
+	}
+
+	var entry [indexEntrySize]byte
+	binary.BigEndian.PutUint64(entry[:], uint64(fs.size))
+	if _, err := fs.index.WriteAt(entry[:], int64(len(fs.offsets)*indexEntrySize)); err != nil {
+		return err
+	}
+	if err := fs.index.Sync(); err != nil {
+		return err
+	}
+	fs.offsets = append(fs.offsets, fs.size)
+	fs.size += int64(len(record))
+	return nil
+}
+
+func (fs *FileStore) Truncate(height int) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	if height < 0 {
+		return fmt.Errorf("store: invalid height %d", height)
+	}
+	if height >= len(fs.offsets) {
+		return nil
+	}
+	// shrink the index first so it never points past the end of the log
+	if err := fs.index.Truncate(int64(height * indexEntrySize)); err != nil {
+		return err
+	}
+	if err := fs.index.Sync(); err != nil {
+		return err
+	}
+	size := fs.offsets[height]
+	if err := fs.log.Truncate(size); err != nil {
+		return err
+	}
+	if err := fs.log.Sync(); err != nil {
+		return err
+	}
+	fs.offsets = fs.offsets[:height]
+	fs.size = size
+	return nil
+}
+
+func (fs *FileStore) TransactionPool() ([]*Transaction, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	m, err := os.ReadFile(filepath.Join(fs.dir, transactionPoolFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Transaction{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	transactions := make([]*Transaction, 0)
+	if err := json.Unmarshal(m, &transactions); err != nil {
+		return nil, fmt.Errorf("store: transaction pool: %w", err)
+	}
+	for i, t := range transactions {
+		if t == nil {
+			return nil, fmt.Errorf("store: transaction pool: null transaction %d", i)
+		}
+	}
+	return transactions, nil
+}
+
+func (fs *FileStore) SaveTransactionPool(transactions []*Transaction) error {
+	m, err := json.Marshal(transactions)
+	if err != nil {
+		return err
+	}
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	// write to a temporary file first so a crash never leaves half a pool
+	path := filepath.Join(fs.dir, transactionPoolFile)
+	if err := os.WriteFile(path+".tmp", m, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (fs *FileStore) Close() error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	err := fs.log.Close()
+	if indexErr := fs.index.Close(); err == nil {
+		err = indexErr
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package block
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func storeBlocks(n int) []*Block {
+	p := RegtestParams()
+	blocks := []*Block{p.Genesis()}
+	for len(blocks) < n {
+		prev := blocks[len(blocks)-1]
+		t := NewTransaction(p.NetworkID, MINING_SENDER, "receiver", 1, 0, uint64(len(blocks)))
+		b := NewBlock(len(blocks), prev.Hash(), []*Transaction{t})
+		b.header.chainID = p.NetworkID
+		b.header.bits = uint32(p.GenesisBits)
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// writeStore fills a new store in dir with blocks and returns the log
+// offset of each of them.
+func writeStore(t *testing.T, dir string, blocks []*Block) []int64 {
+	t.Helper()
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blocks {
+		if err := fs.AppendBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	offsets := append([]int64{}, fs.offsets...)
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return offsets
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func appendFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileStoreRecover(t *testing.T) {
+	blocks := storeBlocks(3)
+	tests := []struct {
+		name string
+		// damage changes the files of a store holding blocks at offsets
+		damage func(t *testing.T, logPath, indexPath string, offsets []int64)
+		want   int
+	}{
+		{
+			"intact",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {},
+			3,
+		},
+		{
+			"torn last record",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				if err := os.Truncate(logPath, fileSize(t, logPath)-5); err != nil {
+					t.Fatal(err)
+				}
+			},
+			2,
+		},
+		{
+			"torn record header",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				if err := os.Truncate(logPath, offsets[2]+recordHeaderSize-1); err != nil {
+					t.Fatal(err)
+				}
+			},
+			2,
+		},
+		{
+			"record header past the end",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				var header [recordHeaderSize]byte
+				binary.BigEndian.PutUint32(header[:], 1<<20)
+				appendFile(t, logPath, append(header[:], "{\"tor"...))
+			},
+			3,
+		},
+		{
+			"index missing the last entries",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				if err := os.Truncate(indexPath, indexEntrySize); err != nil {
+					t.Fatal(err)
+				}
+			},
+			3,
+		},
+		{
+			"torn index entry",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				if err := os.Truncate(indexPath, 2*indexEntrySize+3); err != nil {
+					t.Fatal(err)
+				}
+			},
+			3,
+		},
+		{
+			"index past the end of the log",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				if err := os.Truncate(logPath, offsets[2]); err != nil {
+					t.Fatal(err)
+				}
+			},
+			2,
+		},
+		{
+			"index entry out of order",
+			func(t *testing.T, logPath, indexPath string, offsets []int64) {
+				var entry [indexEntrySize]byte
+				binary.BigEndian.PutUint64(entry[:], uint64(offsets[2]))
+				f, err := os.OpenFile(indexPath, os.O_WRONLY, 0o644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.WriteAt(entry[:], indexEntrySize); err != nil {
+					t.Fatal(err)
+				}
+			},
+			3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			logPath := filepath.Join(dir, blockLogFile)
+			indexPath := filepath.Join(dir, blockIndexFile)
+			offsets := writeStore(t, dir, blocks)
+			tt.damage(t, logPath, indexPath, offsets)
+
+			fs, err := NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkStoredBlocks(t, fs, blocks[:tt.want])
+			// the log and index hold exactly the recovered blocks
+			end := fileSize(t, logPath)
+			if tt.want < len(offsets) && end != offsets[tt.want] {
+				t.Errorf("log size = %d, want %d", end, offsets[tt.want])
+			}
+			if got := fileSize(t, indexPath); got != int64(tt.want*indexEntrySize) {
+				t.Errorf("index size = %d, want %d", got, tt.want*indexEntrySize)
+			}
+
+			// appending after a recovery lands right after the intact prefix
+			more := storeBlocks(tt.want + 1)
+			if err := fs.AppendBlock(more[tt.want]); err != nil {
+				t.Fatal(err)
+			}
+			if err := fs.Close(); err != nil {
+				t.Fatal(err)
+			}
+			fs, err = NewFileStore(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fs.Close()
+			checkStoredBlocks(t, fs, append(blocks[:tt.want:tt.want], more[tt.want]))
+		})
+	}
+}
+
+func checkStoredBlocks(t *testing.T, fs *FileStore, want []*Block) {
+	t.Helper()
+	got, err := fs.Blocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Hash() != want[i].Hash() {
+			t.Errorf("block %d hash = %x, want %x", i, got[i].Hash(), want[i].Hash())
+		}
+	}
+}
+
+func TestFileStoreTruncate(t *testing.T) {
+	dir := t.TempDir()
+	blocks := storeBlocks(4)
+	writeStore(t, dir, blocks)
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Truncate(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs, err = NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	checkStoredBlocks(t, fs, blocks[:2])
+}
@@ -0,0 +1,106 @@
+package block
+
+import "github.com/bc/utils"
+
+// ****************Subsidy Related ****************//
+
+// New coins enter through the premine of the genesis block and through the
+// coinbase. The block at height h creates InitialReward halved once for every
+// HalvingInterval blocks mined before it, counting from height 1, so the
+// total ever created converges to MaxSupply.
+
+// Subsidy is the amount created by the block at height.
+func (p *ChainParams) Subsidy(height int) utils.Amount {
+	if height <= 0 {
+		return 0
+	}
+	halvings := (height - 1) / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+	return p.InitialReward >> uint(halvings)
+}
+
+// premine is the amount the genesis block allocates.
+func (p *ChainParams) premine() utils.Amount {
+	var supply utils.Amount
+	for _, a := range p.Premine {
+		supply += a.Amount
+	}
+	return supply
+}
+
+// supplyAt is the amount created by the blocks up to and including height.
+func (p *ChainParams) supplyAt(height int) utils.Amount {
+	supply := p.premine()
+	for era := 0; era*p.HalvingInterval < height; era++ {
+		blocks := height - era*p.HalvingInterval
+		if blocks > p.HalvingInterval {
+			blocks = p.HalvingInterval
+		}
+		subsidy := p.Subsidy(era*p.HalvingInterval + 1)
+		if subsidy == 0 {
+			break
+		}
+		supply += subsidy * utils.Amount(blocks)
+	}
+	return supply
+}
+
+// subsidySupply is the amount all subsidies together create.
+func (p *ChainParams) subsidySupply() utils.Amount {
+	var supply utils.Amount
+	for subsidy := p.InitialReward; subsidy > 0; subsidy >>= 1 {
+		supply += subsidy * utils.Amount(p.HalvingInterval)
+	}
+	return supply
+}
+
+// MaxSupply is the amount that exists once every subsidy has been paid.
+func (p *ChainParams) MaxSupply() utils.Amount {
+	return p.premine() + p.subsidySupply()
+}
+
+// blockIssuance is what the coinbase of b creates beyond the fees it
+// collects, or the premine for the genesis block. b must have passed
+// validBlock.
+func blockIssuance(b *Block) utils.Amount {
+	var issued utils.Amount
+	for _, t := range b.transactions {
+		if t.senderBlockchainAddress == MINING_SENDER {
+			issued += t.value
+		} else {
+			issued -= t.fee
+		}
+	}
+	return issued
+}
+
+type SupplyResponse struct {
+	Height             int          `json:"height"`
+	CirculatingSupply  utils.Amount `json:"circulating_supply"`
+	MaxSupply          utils.Amount `json:"max_supply"`
+	Subsidy            utils.Amount `json:"subsidy"`
+	HalvingInterval    int          `json:"halving_interval"`
+	NextHalvingHeight  int          `json:"next_halving_height"`
+	BlocksUntilHalving int          `json:"blocks_until_halving"`
+}
+
+// Supply reports the coins created so far and the subsidy of the next block.
+func (bc *BlockChain) Supply() *SupplyResponse {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	p := bc.params
+	height := len(bc.chain) - 1
+	// the next block is height+1; the subsidy first drops at era*interval+1
+	nextHalving := (height/p.HalvingInterval+1)*p.HalvingInterval + 1
+	return &SupplyResponse{
+		Height:             height,
+		CirculatingSupply:  p.supplyAt(height),
+		MaxSupply:          p.MaxSupply(),
+		Subsidy:            p.Subsidy(height + 1),
+		HalvingInterval:    p.HalvingInterval,
+		NextHalvingHeight:  nextHalving,
+		BlocksUntilHalving: nextHalving - (height + 1),
+	}
+}
@@ -0,0 +1,470 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/bc/utils"
+)
+
+// ****************UTXO Related ****************//
+
+// A chain keeps either the account ledger or the UTXO ledger, chosen when it
+// is created. In the UTXO ledger a transaction spends whole outputs of
+// confirmed transactions through its inputs and creates new outputs; the
+// inputs must add up to the outputs plus the fee, so change goes back to the
+// sender as an output of its own. Each input carries the public key of the
+// address owning the output it spends and a signature over the signing hash
+// of the transaction. Inputs may not spend outputs created in the same block
+// or still waiting in the pool.
+//
+// The coinbase keeps its account form and creates output 0 paying its
+// receiver. Outputs of a coinbase are spendable after the coinbase maturity
+// of the chain params, like account rewards; genesis allocations at once.
+
+const (
+	LEDGER_ACCOUNT = "account"
+	LEDGER_UTXO    = "utxo"
+)
+
+var (
+	ErrLedgerMismatch        = errors.New("transaction does not fit the ledger of the chain")
+	ErrNotUTXOLedger         = errors.New("chain does not keep a utxo ledger")
+	ErrMissingInput          = errors.New("input spends an unknown or spent output")
+	ErrDoubleSpend           = errors.New("output spent twice")
+	ErrImmatureCoinbase      = errors.New("input spends an immature coinbase")
+	ErrInputOwner            = errors.New("input key does not own the spent output")
+	ErrUnbalancedTransaction = errors.New("inputs do not match outputs plus fee")
+)
+
+// OutPoint names output Index of transaction TxID.
+type OutPoint struct {
+	TxID  [32]byte
+	Index uint32
+}
+
+type TxInput struct {
+	PreviousOutput OutPoint
+	PublicKey      *ecdsa.PublicKey
+	Signature      *utils.Signature
+}
+
+type TxOutput struct {
+	Address string       `json:"address"`
+	Value   utils.Amount `json:"value"`
+}
+
+// UnspentOutput describes an output of the UTXO set. Spendable is false while
+// it is an immature coinbase or spent by a pool transaction.
+type UnspentOutput struct {
+	OutPoint  OutPoint     `json:"outpoint"`
+	Address   string       `json:"address"`
+	Value     utils.Amount `json:"value"`
+	Height    int          `json:"height"`
+	Coinbase  bool         `json:"coinbase"`
+	Spendable bool         `json:"spendable"`
+}
+
+// NewUTXOTransaction creates a UTXO transaction on the chain chainID; its
+// inputs still need their keys and signatures over SigningHash.
+func NewUTXOTransaction(chainID uint32, inputs []*TxInput, outputs []*TxOutput, fee utils.Amount) *Transaction {
+	return &Transaction{chainID: chainID, inputs: inputs, outputs: outputs, fee: fee}
+}
+
+// isUTXO reports whether t is in the UTXO form.
+func (t *Transaction) isUTXO() bool {
+	return len(t.inputs) > 0 || len(t.outputs) > 0
+}
+
+func (t *Transaction) Inputs() []*TxInput {
+	return t.inputs
+}
+
+func (t *Transaction) Outputs() []*TxOutput {
+	return t.outputs
+}
+
+func (t *Transaction) Fee() utils.Amount {
+	return t.fee
+}
+
+// createdOutputs lists the outputs t adds to the UTXO set.
+func (t *Transaction) createdOutputs() []*TxOutput {
+	if t.senderBlockchainAddress == MINING_SENDER {
+		return []*TxOutput{{Address: t.receiverBlockchainAddress, Value: t.value}}
+	}
+	return t.outputs
+}
+
+// checkUTXOForm runs the checks of a UTXO transaction that need no ledger:
+// shape, amounts, distinct inputs and signatures.
+func checkUTXOForm(t *Transaction) error {
+	if t.senderBlockchainAddress != "" || t.receiverBlockchainAddress != "" || t.value != 0 || t.nonce != 0 {
+		return fmt.Errorf("%w: account fields set on a utxo transaction", ErrLedgerMismatch)
+	}
+	if len(t.inputs) == 0 || len(t.outputs) == 0 {
+		return fmt.Errorf("%w: utxo transaction needs inputs and outputs", ErrLedgerMismatch)
+	}
+	if t.fee < 0 {
+		return ErrInvalidFee
+	}
+	for _, out := range t.outputs {
+		if out.Value <= 0 {
+			return ErrInvalidValue
+		}
+	}
+	hash := t.SigningHash()
+	seen := make(map[OutPoint]bool)
+	for _, in := range t.inputs {
+		if seen[in.PreviousOutput] {
+			return ErrDoubleSpend
+		}
+		seen[in.PreviousOutput] = true
+		if in.PublicKey == nil || in.Signature == nil || !ecdsa.Verify(in.PublicKey, hash[:], in.Signature.R, in.Signature.S) {
+			return ErrInvalidSignature
+		}
+	}
+	return nil
+}
+
+// utxoEntry is an unspent output and where it was created.
+type utxoEntry struct {
+	output   TxOutput
+	height   int
+	coinbase bool
+}
+
+// spentOutput remembers an output a block spent so that disconnecting the
+// block can restore it.
+type spentOutput struct {
+	outPoint OutPoint
+	entry    *utxoEntry
+}
+
+type utxoSet struct {
+	entries        map[OutPoint]*utxoEntry
+	maturity       int
+	addressVersion byte
+}
+
+// newUTXOSet creates an empty set following the coinbase maturity and the
+// address version of p.
+func newUTXOSet(p *ChainParams) *utxoSet {
+	return &utxoSet{entries: make(map[OutPoint]*utxoEntry), maturity: p.CoinbaseMaturity, addressVersion: p.AddressVersion}
+}
+
+// checkTransaction checks that the inputs of t exist, are owned by their
+// keys, are mature at height and are not in spent, and that they add up to
+// the outputs plus the fee. The inputs are added to spent.
+func (s *utxoSet) checkTransaction(t *Transaction, height int, spent map[OutPoint]bool) error {
+	if !t.isUTXO() {
+		return fmt.Errorf("%w: account transaction in a utxo ledger", ErrLedgerMismatch)
+	}
+	var in utils.Amount
+	var err error
+	for _, input := range t.inputs {
+		op := input.PreviousOutput
+		if spent[op] {
+			return fmt.Errorf("%w: %s", ErrDoubleSpend, op)
+		}
+		e, ok := s.entries[op]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrMissingInput, op)
+		}
+		if e.coinbase && height-e.height < s.maturity {
+			return fmt.Errorf("%w: %s", ErrImmatureCoinbase, op)
+		}
+		if utils.BlockchainAddress(input.PublicKey, s.addressVersion) != e.output.Address {
+			return fmt.Errorf("%w: %s", ErrInputOwner, op)
+		}
+		if in, err = in.Add(e.output.Value); err != nil {
+			return err
+		}
+	}
+	out := t.fee
+	for _, o := range t.outputs {
+		if out, err = out.Add(o.Value); err != nil {
+			return err
+		}
+	}
+	if in != out {
+		return fmt.Errorf("%w: inputs %s, outputs plus fee %s", ErrUnbalancedTransaction, in, out)
+	}
+	for _, input := range t.inputs {
+		spent[input.PreviousOutput] = true
+	}
+	return nil
+}
+
+// checkBlock checks every transaction of b against the set, which is left
+// untouched.
+func (s *utxoSet) checkBlock(b *Block, height int) *ChainError {
+	spent := make(map[OutPoint]bool)
+	for i, t := range b.transactions {
+		if t.senderBlockchainAddress == MINING_SENDER {
+			continue
+		}
+		if err := s.checkTransaction(t, height, spent); err != nil {
+			return chainErrorf(height, "transaction %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// connectBlock spends the inputs of b and adds its outputs, returning the
+// spent outputs for disconnectBlock. b must have passed checkBlock.
+func (s *utxoSet) connectBlock(b *Block, height int) []spentOutput {
+	var spent []spentOutput
+	for _, t := range b.transactions {
+		for _, input := range t.inputs {
+			spent = append(spent, spentOutput{outPoint: input.PreviousOutput, entry: s.entries[input.PreviousOutput]})
+			delete(s.entries, input.PreviousOutput)
+		}
+		id := t.ID()
+		coinbase := t.senderBlockchainAddress == MINING_SENDER && height > 0
+		for i, out := range t.createdOutputs() {
+			s.entries[OutPoint{TxID: id, Index: uint32(i)}] = &utxoEntry{output: *out, height: height, coinbase: coinbase}
+		}
+	}
+	return spent
+}
+
+// disconnectBlock undoes connectBlock.
+func (s *utxoSet) disconnectBlock(b *Block, spent []spentOutput) {
+	for _, t := range b.transactions {
+		id := t.ID()
+		for i := range t.createdOutputs() {
+			delete(s.entries, OutPoint{TxID: id, Index: uint32(i)})
+		}
+	}
+	for _, so := range spent {
+		if so.entry != nil {
+			s.entries[so.outPoint] = so.entry
+		}
+	}
+}
+
+// connectUTXOBlock updates the UTXO set for b appended at height. The caller
+// must hold bc.mux.
+func (bc *BlockChain) connectUTXOBlock(b *Block, height int) {
+	if bc.utxos == nil {
+		return
+	}
+	bc.spentOutputs = append(bc.spentOutputs[:height], bc.utxos.connectBlock(b, height))
+}
+
+// disconnectUTXOBlocks rolls the UTXO set back to before the block at
+// height. The caller must hold bc.mux.
+func (bc *BlockChain) disconnectUTXOBlocks(height int) {
+	if bc.utxos == nil {
+		return
+	}
+	for h := len(bc.chain) - 1; h >= height; h-- {
+		bc.utxos.disconnectBlock(bc.chain[h], bc.spentOutputs[h])
+	}
+	bc.spentOutputs = bc.spentOutputs[:height]
+}
+
+// poolSpends marks the outputs spent by pool transactions. The caller must
+// hold bc.mux.
+func (bc *BlockChain) poolSpends() map[OutPoint]bool {
+	spent := make(map[OutPoint]bool)
+	for _, t := range bc.transactionPool {
+		for _, input := range t.inputs {
+			spent[input.PreviousOutput] = true
+		}
+	}
+	return spent
+}
+
+// addUTXOTransaction puts t in the pool of a UTXO ledger. The caller must
+// hold bc.mux.
+func (bc *BlockChain) addUTXOTransaction(t *Transaction) error {
+	if !t.isUTXO() {
+		return fmt.Errorf("%w: account transaction in a utxo ledger", ErrLedgerMismatch)
+	}
+	if err := checkUTXOForm(t); err != nil {
+		return err
+	}
+	id := t.ID()
+	if bc.seen(id) {
+		return ErrDuplicateTransaction
+	}
+	if err := bc.utxos.checkTransaction(t, len(bc.chain), bc.poolSpends()); err != nil {
+		return err
+	}
+	bc.markSeen(id)
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.saveTransactionPool()
+	return nil
+}
+
+// revalidateUTXOPool keeps the pool transactions whose inputs are still
+// unspent and mature. The caller must hold bc.mux.
+func (bc *BlockChain) revalidateUTXOPool() {
+	spent := make(map[OutPoint]bool)
+	transactionPool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if bc.utxos.checkTransaction(t, len(bc.chain), spent) == nil {
+			transactionPool = append(transactionPool, t)
+		}
+	}
+	if len(transactionPool) != len(bc.transactionPool) {
+		bc.transactionPool = transactionPool
+		bc.saveTransactionPool()
+	}
+}
+
+// spendableUTXOBalance sums the outputs of blockchainAddress that a new
+// transaction may spend. The caller must hold bc.mux.
+func (bc *BlockChain) spendableUTXOBalance(blockchainAddress string) (utils.Amount, error) {
+	var total utils.Amount
+	var err error
+	for _, u := range bc.unspentOutputs(blockchainAddress) {
+		if u.Spendable {
+			if total, err = total.Add(u.Value); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return total, nil
+}
+
+func (bc *BlockChain) unspentOutputs(blockchainAddress string) []*UnspentOutput {
+	spent := bc.poolSpends()
+	height := len(bc.chain)
+	unspent := make([]*UnspentOutput, 0)
+	for op, e := range bc.utxos.entries {
+		if e.output.Address != blockchainAddress {
+			continue
+		}
+		unspent = append(unspent, &UnspentOutput{
+			OutPoint:  op,
+			Address:   e.output.Address,
+			Value:     e.output.Value,
+			Height:    e.height,
+			Coinbase:  e.coinbase,
+			Spendable: !spent[op] && !(e.coinbase && height-e.height < bc.utxos.maturity),
+		})
+	}
+	sort.Slice(unspent, func(i, j int) bool {
+		if unspent[i].Height != unspent[j].Height {
+			return unspent[i].Height < unspent[j].Height
+		}
+		return unspent[i].OutPoint.String() < unspent[j].OutPoint.String()
+	})
+	return unspent
+}
+
+// UnspentOutputs lists the unspent outputs of blockchainAddress, oldest
+// first.
+func (bc *BlockChain) UnspentOutputs(blockchainAddress string) ([]*UnspentOutput, error) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.utxos == nil {
+		return nil, ErrNotUTXOLedger
+	}
+	return bc.unspentOutputs(blockchainAddress), nil
+}
+
+// CreateUTXOTransaction adds a signed UTXO transaction to the pool, relays
+// it to the neighbors and returns its id. chainID must be the network id of
+// the chain.
+func (bc *BlockChain) CreateUTXOTransaction(chainID uint32, inputs []*TxInput, outputs []*TxOutput, fee utils.Amount) ([32]byte, error) {
+	t := NewUTXOTransaction(chainID, inputs, outputs, fee)
+	bc.mux.Lock()
+	err := bc.addTransaction(t)
+	bc.mux.Unlock()
+	if err != nil {
+		log.Printf("ERROR: Add Transaction %v", err)
+		return t.ID(), err
+	}
+	bc.broadcastTransaction(t)
+	return t.ID(), nil
+}
+
+func (op OutPoint) String() string {
+	return fmt.Sprintf("%x:%d", op.TxID, op.Index)
+}
+
+func (op OutPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TxID  string `json:"txid"`
+		Index uint32 `json:"index"`
+	}{
+		TxID:  fmt.Sprintf("%x", op.TxID),
+		Index: op.Index,
+	})
+}
+
+func (op *OutPoint) UnmarshalJSON(data []byte) error {
+	var txID string
+	v := &struct {
+		TxID  *string `json:"txid"`
+		Index *uint32 `json:"index"`
+	}{
+		TxID:  &txID,
+		Index: &op.Index,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	var err error
+	op.TxID, err = decodeHash("txid", txID)
+	return err
+}
+
+func (in *TxInput) MarshalJSON() ([]byte, error) {
+	var publicKey, signature string
+	if in.PublicKey != nil {
+		publicKey = fmt.Sprintf("%064x%064x", in.PublicKey.X, in.PublicKey.Y)
+	}
+	if in.Signature != nil {
+		signature = in.Signature.String()
+	}
+	return json.Marshal(struct {
+		PreviousOutput OutPoint `json:"previous_output"`
+		PublicKey      string   `json:"public_key"`
+		Signature      string   `json:"signature"`
+	}{
+		PreviousOutput: in.PreviousOutput,
+		PublicKey:      publicKey,
+		Signature:      signature,
+	})
+}
+
+func (in *TxInput) UnmarshalJSON(data []byte) error {
+	var publicKey, signature string
+	v := &struct {
+		PreviousOutput *OutPoint `json:"previous_output"`
+		PublicKey      *string   `json:"public_key"`
+		Signature      *string   `json:"signature"`
+	}{
+		PublicKey: &publicKey,
+		Signature: &signature,
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.PreviousOutput == nil {
+		return fmt.Errorf("missing previous_output")
+	}
+	in.PreviousOutput = *v.PreviousOutput
+	if publicKey != "" {
+		if !isKeyString(publicKey) {
+			return fmt.Errorf("invalid public_key %q", publicKey)
+		}
+		in.PublicKey = utils.PublicKeyFromString(publicKey)
+	}
+	if signature != "" {
+		if !isKeyString(signature) {
+			return fmt.Errorf("invalid signature %q", signature)
+		}
+		in.Signature = utils.SignatureFromString(signature)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package block
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bc/utils"
+)
+
+func TestUTXOCheckTransaction(t *testing.T) {
+	p := RegtestParams()
+	p.Ledger = LEDGER_UTXO
+	aliceKey, alice := newTestKey(t, p)
+	bobKey, bob := newTestKey(t, p)
+	s := newUTXOSet(p)
+	genesis := &Block{transactions: []*Transaction{NewTransaction(p.NetworkID, MINING_SENDER, alice, 10*utils.COIN, 0, GENESIS_ALLOCATION_NONCE)}}
+	s.connectBlock(genesis, 0)
+	reward := coinbaseBlock(p, 1, alice, utils.COIN)
+	s.connectBlock(reward, 1)
+	allocation := OutPoint{TxID: genesis.transactions[0].ID()}
+	coinbase := OutPoint{TxID: reward.transactions[0].ID()}
+
+	spend := func(op OutPoint, fee utils.Amount, outputs ...*TxOutput) *Transaction {
+		return NewUTXOTransaction(p.NetworkID, []*TxInput{{PreviousOutput: op, PublicKey: &aliceKey.PublicKey}}, outputs, fee)
+	}
+	pay := func(to string, value utils.Amount) *TxOutput {
+		return &TxOutput{Address: to, Value: value}
+	}
+	tests := []struct {
+		name   string
+		t      *Transaction
+		height int
+		spent  bool
+		err    error
+	}{
+		{"spend with change", spend(allocation, utils.COIN, pay(bob, 6*utils.COIN), pay(alice, 3*utils.COIN)), 2, false, nil},
+		{"unknown output", spend(OutPoint{TxID: allocation.TxID, Index: 1}, 0, pay(bob, 10*utils.COIN)), 2, false, ErrMissingInput},
+		{"spent output", spend(allocation, 0, pay(bob, 10*utils.COIN)), 2, true, ErrDoubleSpend},
+		{"immature coinbase", spend(coinbase, 0, pay(bob, utils.COIN)), 1 + p.CoinbaseMaturity - 1, false, ErrImmatureCoinbase},
+		{"mature coinbase", spend(coinbase, 0, pay(bob, utils.COIN)), 1 + p.CoinbaseMaturity, false, nil},
+		{"outputs over inputs", spend(allocation, 0, pay(bob, 11*utils.COIN)), 2, false, ErrUnbalancedTransaction},
+		{"fee left out", spend(allocation, 0, pay(bob, 9*utils.COIN)), 2, false, ErrUnbalancedTransaction},
+		{"account transaction", NewTransaction(p.NetworkID, alice, bob, utils.COIN, 0, 0), 2, false, ErrLedgerMismatch},
+	}
+	for _, tt := range tests {
+		spent := make(map[OutPoint]bool)
+		if tt.spent {
+			for _, in := range tt.t.inputs {
+				spent[in.PreviousOutput] = true
+			}
+		}
+		err := s.checkTransaction(tt.t, tt.height, spent)
+		if tt.err == nil && err != nil || tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+		if err == nil && !spent[tt.t.inputs[0].PreviousOutput] {
+			t.Errorf("%s: input not marked spent", tt.name)
+		}
+	}
+
+	stolen := spend(allocation, 0, pay(bob, 10*utils.COIN))
+	stolen.inputs[0].PublicKey = &bobKey.PublicKey
+	if err := s.checkTransaction(stolen, 2, map[OutPoint]bool{}); !errors.Is(err, ErrInputOwner) {
+		t.Errorf("foreign key: error %v, want %v", err, ErrInputOwner)
+	}
+}
+
+// utxoSnapshot copies the entries of s.
+func utxoSnapshot(s *utxoSet) map[OutPoint]utxoEntry {
+	snapshot := make(map[OutPoint]utxoEntry, len(s.entries))
+	for op, e := range s.entries {
+		snapshot[op] = *e
+	}
+	return snapshot
+}
+
+func TestUTXOConnectDisconnect(t *testing.T) {
+	p := RegtestParams()
+	p.Ledger = LEDGER_UTXO
+	aliceKey, alice := newTestKey(t, p)
+	_, bob := newTestKey(t, p)
+	s := newUTXOSet(p)
+	genesis := &Block{transactions: []*Transaction{NewTransaction(p.NetworkID, MINING_SENDER, alice, 10*utils.COIN, 0, GENESIS_ALLOCATION_NONCE)}}
+	s.connectBlock(genesis, 0)
+	before := utxoSnapshot(s)
+
+	allocation := OutPoint{TxID: genesis.transactions[0].ID()}
+	tx := NewUTXOTransaction(p.NetworkID, []*TxInput{{PreviousOutput: allocation, PublicKey: &aliceKey.PublicKey}},
+		[]*TxOutput{{Address: bob, Value: 6 * utils.COIN}, {Address: alice, Value: 3 * utils.COIN}}, utils.COIN)
+	b := coinbaseBlock(p, 1, bob, p.Subsidy(1)+utils.COIN)
+	b.transactions = append(b.transactions, tx)
+	if err := s.checkBlock(b, 1); err != nil {
+		t.Fatal(err)
+	}
+	spent := s.connectBlock(b, 1)
+
+	if _, ok := s.entries[allocation]; ok {
+		t.Errorf("spent allocation still unspent")
+	}
+	want := map[OutPoint]utils.Amount{
+		{TxID: b.transactions[0].ID()}: p.Subsidy(1) + utils.COIN,
+		{TxID: tx.ID(), Index: 0}:      6 * utils.COIN,
+		{TxID: tx.ID(), Index: 1}:      3 * utils.COIN,
+	}
+	if len(s.entries) != len(want) {
+		t.Errorf("%d unspent outputs, want %d", len(s.entries), len(want))
+	}
+	for op, value := range want {
+		if e, ok := s.entries[op]; !ok || e.output.Value != value || e.height != 1 {
+			t.Errorf("output %s = %+v, want %s at height 1", op, e, value)
+		}
+	}
+	if err := s.checkBlock(b, 1); err == nil {
+		t.Errorf("block valid again after connecting it")
+	}
+
+	s.disconnectBlock(b, spent)
+	after := utxoSnapshot(s)
+	if len(after) != len(before) {
+		t.Fatalf("%d unspent outputs after disconnecting, want %d", len(after), len(before))
+	}
+	for op, e := range before {
+		if after[op] != e {
+			t.Errorf("output %s = %+v after disconnecting, want %+v", op, after[op], e)
+		}
+	}
+}
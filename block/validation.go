@@ -0,0 +1,169 @@
+package block
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bc/utils"
+)
+
+// ****************Validation Related ****************//
+
+// ChainError names the first block of a chain that failed validation.
+type ChainError struct {
+	Height int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("block %d: %s", e.Height, e.Reason)
+}
+
+func chainErrorf(height int, format string, a ...interface{}) *ChainError {
+	return &ChainError{Height: height, Reason: fmt.Sprintf(format, a...)}
+}
+
+// ValidChain walks chain from the genesis block of p, replaying it on the
+// ledger of p, and returns a *ChainError for the first block that is not
+// internally consistent, or nil.
+func ValidChain(chain []*Block, p *ChainParams) error {
+	if len(chain) == 0 {
+		return chainErrorf(0, "empty chain")
+	}
+	if genesis := p.Genesis(); chain[0].Hash() != genesis.Hash() {
+		return chainErrorf(0, "genesis %x is not the %s genesis %x", chain[0].Hash(), p.Name, genesis.Hash())
+	}
+	accounts := newAccounts(p.CoinbaseMaturity)
+	var utxos *utxoSet
+	if p.Ledger == LEDGER_UTXO {
+		utxos = newUTXOSet(p)
+	}
+	var supply utils.Amount
+	for i := 0; i < len(chain); i++ {
+		if i > 0 {
+			if err := validBlock(chain[i], chain[:i], p); err != nil {
+				return err
+			}
+		}
+		supply += blockIssuance(chain[i])
+		if supply > p.MaxSupply() {
+			return chainErrorf(i, "supply %s exceeds the cap of %s", supply, p.MaxSupply())
+		}
+		if utxos != nil {
+			if err := utxos.checkBlock(chain[i], i); err != nil {
+				return err
+			}
+			utxos.connectBlock(chain[i], i)
+			continue
+		}
+		if err := accounts.apply(chain[i], i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validBlock checks that b can follow the blocks in parents under the rules
+// of p.
+func validBlock(b *Block, parents []*Block, p *ChainParams) *ChainError {
+	height := len(parents)
+	prev := parents[height-1]
+	if b.header.chainID != p.NetworkID {
+		return chainErrorf(height, "%v: chain id %d, want %d", ErrChainIDMismatch, b.header.chainID, p.NetworkID)
+	}
+	if b.header.previousHash != prev.Hash() {
+		return chainErrorf(height, "previous hash %x does not match block %d hash %x", b.header.previousHash, height-1, prev.Hash())
+	}
+	if b.header.timeStamp <= prev.header.timeStamp {
+		return chainErrorf(height, "timestamp %d is not after previous timestamp %d", b.header.timeStamp, prev.header.timeStamp)
+	}
+	if limit := time.Now().Add(MAX_FUTURE_BLOCK_TIME_SEC * time.Second).UnixNano(); b.header.timeStamp > limit {
+		return chainErrorf(height, "timestamp %d is more than %d seconds ahead of local time", b.header.timeStamp, MAX_FUTURE_BLOCK_TIME_SEC)
+	}
+	if root := merkleRootOf(b.transactions); b.header.merkleRoot != root {
+		return chainErrorf(height, "merkle root %x does not match transactions root %x", b.header.merkleRoot, root)
+	}
+	if bits := nextBits(parents, p); b.header.bits != bits {
+		return chainErrorf(height, "bits %08x, want %08x", b.header.bits, bits)
+	}
+	if !validProof(&b.header, p) {
+		return chainErrorf(height, "nonce %d does not meet target bits %08x", b.header.nonce, b.header.bits)
+	}
+	if size := blockSize(b); size > MAX_BLOCK_SIZE {
+		return chainErrorf(height, "size %d exceeds %d bytes", size, MAX_BLOCK_SIZE)
+	}
+	if len(b.transactions) == 0 || b.transactions[0].senderBlockchainAddress != MINING_SENDER {
+		return chainErrorf(height, "first transaction is not a coinbase")
+	}
+	coinbase := b.transactions[0]
+	var fees utils.Amount
+	for i, t := range b.transactions {
+		if err := p.checkNetwork(t); err != nil {
+			return chainErrorf(height, "transaction %d: %v", i, err)
+		}
+		if t.senderBlockchainAddress == MINING_SENDER {
+			if i != 0 {
+				return chainErrorf(height, "transaction %d: coinbase after the first transaction", i)
+			}
+			if t.fee != 0 {
+				return chainErrorf(height, "transaction %d: coinbase pays fee %s", i, t.fee)
+			}
+			if t.nonce != uint64(height) {
+				return chainErrorf(height, "transaction %d: coinbase nonce %d is not the block height", i, t.nonce)
+			}
+			continue
+		}
+		if t.isUTXO() {
+			if err := checkUTXOForm(t); err != nil {
+				return chainErrorf(height, "transaction %d: %v", i, err)
+			}
+		} else {
+			if t.value <= 0 {
+				return chainErrorf(height, "transaction %d: value %s is not positive", i, t.value)
+			}
+			if t.fee < 0 {
+				return chainErrorf(height, "transaction %d: fee %s is negative", i, t.fee)
+			}
+			if !verifyTransactionSignature(t.senderPublicKey, t.signature, t) {
+				return chainErrorf(height, "transaction %d: invalid signature", i)
+			}
+			if !ownsAddress(t.senderPublicKey, t.senderBlockchainAddress, p.AddressVersion) {
+				return chainErrorf(height, "transaction %d: sender key does not own %s", i, t.senderBlockchainAddress)
+			}
+		}
+		var err error
+		if fees, err = fees.Add(t.fee); err != nil {
+			return chainErrorf(height, "transaction %d: fees %v", i, err)
+		}
+	}
+	if reward, err := p.Subsidy(height).Add(fees); err != nil || coinbase.value != reward {
+		return chainErrorf(height, "coinbase value %s is not the subsidy %s plus fees %s", coinbase.value, p.Subsidy(height), fees)
+	}
+	return nil
+}
+
+// checkHeader runs the checks of h that need no parent: the chain id, a
+// target within the proof of work limit met by the hash of h, and a
+// timestamp at most MAX_FUTURE_BLOCK_TIME_SEC ahead of local time.
+func checkHeader(h *BlockHeader, p *ChainParams) error {
+	if h.chainID != p.NetworkID {
+		return fmt.Errorf("%w: chain id %d, want %d", ErrChainIDMismatch, h.chainID, p.NetworkID)
+	}
+	if !validProof(h, p) {
+		return fmt.Errorf("nonce %d does not meet target bits %08x", h.nonce, h.bits)
+	}
+	if limit := time.Now().Add(MAX_FUTURE_BLOCK_TIME_SEC * time.Second).UnixNano(); h.timeStamp > limit {
+		return fmt.Errorf("timestamp %d is more than %d seconds ahead of local time", h.timeStamp, MAX_FUTURE_BLOCK_TIME_SEC)
+	}
+	return nil
+}
+
+// Validate runs ValidChain on the local chain. Blocks never change once
+// appended, so the replay runs on a copy of the chain without bc.mux.
+func (bc *BlockChain) Validate() error {
+	bc.mux.Lock()
+	chain := make([]*Block, len(bc.chain))
+	copy(chain, bc.chain)
+	bc.mux.Unlock()
+	return ValidChain(chain, bc.params)
+}
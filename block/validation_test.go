@@ -0,0 +1,104 @@
+package block
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bc/utils"
+)
+
+// childBlock returns a block of p holding transactions on top of parents,
+// with its proof of work done.
+func childBlock(p *ChainParams, parents []*Block, transactions ...*Transaction) *Block {
+	b := NewBlock(0, parents[len(parents)-1].Hash(), transactions)
+	b.header.chainID = p.NetworkID
+	b.header.bits = nextBits(parents, p)
+	for !validProof(&b.header, p) {
+		b.header.nonce++
+	}
+	return b
+}
+
+func TestValidateWhileMining(t *testing.T) {
+	bc := newTestChain(t, RegtestParams())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if !bc.Mining() {
+				t.Errorf("mining block %d failed", i+1)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := bc.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if err := bc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidBlockCoinbaseRules(t *testing.T) {
+	p := RegtestParams()
+	parents := []*Block{p.Genesis()}
+	_, miner := newTestKey(t, p)
+	coinbase := func(value utils.Amount, fee utils.Amount, nonce uint64) *Transaction {
+		return NewTransaction(p.NetworkID, MINING_SENDER, miner, value, fee, nonce)
+	}
+	reward := p.Subsidy(1)
+	tests := []struct {
+		name         string
+		transactions []*Transaction
+		ok           bool
+	}{
+		{"subsidy", []*Transaction{coinbase(reward, 0, 1)}, true},
+		{"no transactions", nil, false},
+		{"more than the subsidy", []*Transaction{coinbase(reward+1, 0, 1)}, false},
+		{"less than the subsidy", []*Transaction{coinbase(reward-1, 0, 1)}, false},
+		{"coinbase paying a fee", []*Transaction{coinbase(reward, 1, 1)}, false},
+		{"nonce not the height", []*Transaction{coinbase(reward, 0, 0)}, false},
+		{"second coinbase", []*Transaction{coinbase(reward, 0, 1), coinbase(reward, 0, 1)}, false},
+	}
+	for _, tt := range tests {
+		err := validBlock(childBlock(p, parents, tt.transactions...), parents, p)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: validBlock error %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestCoinbaseMaturity(t *testing.T) {
+	p := RegtestParams()
+	p.CoinbaseMaturity = 3
+	a := newAccounts(p.CoinbaseMaturity)
+	if err := a.apply(coinbaseBlock(p, 1, "miner", utils.COIN), 1); err != nil {
+		t.Fatal(err)
+	}
+	spend := func(height int, nonce uint64) *Block {
+		b := coinbaseBlock(p, height, "other", utils.COIN)
+		b.transactions = append(b.transactions, NewTransaction(p.NetworkID, "miner", "bob", utils.COIN, 0, nonce))
+		return b
+	}
+	// the reward of block 1 matures at height 1+CoinbaseMaturity
+	for height := 2; height < 1+p.CoinbaseMaturity; height++ {
+		if err := a.apply(spend(height, 0), height); err == nil {
+			t.Fatalf("immature reward spent at height %d", height)
+		}
+	}
+	if err := a.apply(spend(1+p.CoinbaseMaturity, 0), 1+p.CoinbaseMaturity); err != nil {
+		t.Fatalf("mature reward: %v", err)
+	}
+}
+
+func TestAddTransactionRefusesCoinbase(t *testing.T) {
+	bc := newTestChain(t, RegtestParams())
+	err := bc.AddTransaction(bc.params.NetworkID, MINING_SENDER, bc.blockchainAddress, utils.COIN, 0, 0, nil, nil)
+	if !errors.Is(err, ErrCoinbaseTransaction) {
+		t.Errorf("coinbase through the pool: %v, want %v", err, ErrCoinbaseTransaction)
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/bc/utils"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/bc/block"
 	"github.com/bc/wallet"
@@ -16,12 +23,18 @@ import (
 
 var cache map[string]*block.BlockChain = make(map[string]*block.BlockChain)
 
+const MINER_KEY_FILE = "miner.key"
+
 type BlockchainServer struct {
-	port uint16
+	port    uint16
+	dataDir string
+	params  *block.ChainParams
 }
 
-func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
+// NewBlockchainServer creates a server keeping its chain under dataDir, or only
+// in memory when dataDir is empty, on the network of params.
+func NewBlockchainServer(port uint16, dataDir string, params *block.ChainParams) *BlockchainServer {
+	return &BlockchainServer{port: port, dataDir: dataDir, params: params}
 }
 
 func (bcs *BlockchainServer) Port() uint16 {
@@ -31,16 +44,50 @@ func (bcs *BlockchainServer) Port() uint16 {
 func (bcs *BlockchainServer) GetBlockChain() *block.BlockChain {
 	bc, ok := cache["blockchain"]
 	if !ok {
-		minerWallet := wallet.NewWallet()
-		bc = block.NewBlockChain(minerWallet.BlockchainAddress(), bcs.Port())
+		store := bcs.newStore()
+		minerWallet := bcs.minerWallet()
+		var err error
+		bc, err = block.NewBlockChainWithParams(minerWallet.BlockchainAddress(), bcs.Port(), store, bcs.params)
+		if err != nil {
+			log.Fatalf("ERROR: Load blockchain %v", err)
+		}
 		cache["blockchain"] = bc
-		//log.Printf("privatekey %v", minerWallet.PrivateKeyStr())
-		//log.Printf("publicKey %v", minerWallet.PublicKeyStr())
-		//log.Printf("walletAddress %v", minerWallet.BlockchainAddress())
+		log.Printf("action=start, miner_address=%s", minerWallet.BlockchainAddress())
 	}
 	return bc
 }
 
+// storeDir is the directory of the chain store; every network and port gets
+// its own so several nodes can share dataDir.
+func (bcs *BlockchainServer) storeDir() string {
+	return filepath.Join(bcs.dataDir, bcs.params.Name, strconv.Itoa(int(bcs.Port())))
+}
+
+func (bcs *BlockchainServer) newStore() block.Store {
+	if bcs.dataDir == "" {
+		return block.NewMemoryStore()
+	}
+	store, err := block.NewFileStore(bcs.storeDir())
+	if err != nil {
+		log.Fatalf("ERROR: Open store %v", err)
+	}
+	return store
+}
+
+// minerWallet is the wallet the coinbase rewards are paid to. Its key is kept
+// next to the chain store so the rewards stay spendable across restarts; an
+// in-memory chain gets a fresh one.
+func (bcs *BlockchainServer) minerWallet() *wallet.Wallet {
+	if bcs.dataDir == "" {
+		return wallet.NewWallet(bcs.params.AddressVersion)
+	}
+	w, err := wallet.LoadWallet(filepath.Join(bcs.storeDir(), MINER_KEY_FILE), bcs.params.AddressVersion)
+	if err != nil {
+		log.Fatalf("ERROR: Load miner wallet %v", err)
+	}
+	return w
+}
+
 func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -68,30 +115,52 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, r *http.Request
 			Length:       len(transactions),
 		})
 		io.WriteString(w, string(m))
-	case http.MethodPost:
+	case http.MethodPost, http.MethodPut:
+		// POST comes from wallets, PUT from neighbors relaying a transaction
 		decoder := json.NewDecoder(r.Body)
 		var t block.TransactionRequest
 		err := decoder.Decode(&t)
 		if err != nil {
 			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
 		}
 		if !t.Validate() {
 			log.Println("ERROR: Some fields are missing")
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
 		}
-		publickey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockChain()
-		isCreated := bc.CreateTransaction(*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, *t.Value, publickey, signature)
+		var fee utils.Amount
+		if t.Fee != nil {
+			fee = *t.Fee
+		}
+		var id [32]byte
+		if len(t.Inputs) > 0 {
+			id, err = bc.CreateUTXOTransaction(*t.ChainID, t.Inputs, t.Outputs, fee)
+		} else {
+			publickey := utils.PublicKeyFromString(*t.SenderPublicKey)
+			signature := utils.SignatureFromString(*t.Signature)
+			id, err = bc.CreateTransaction(*t.ChainID, *t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, *t.Value, fee, *t.Nonce, publickey, signature)
+		}
 		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isCreated {
+		if err != nil {
 			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JSONStatus("Failed")
-		} else {
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		if r.Method == http.MethodPost {
 			w.WriteHeader(http.StatusCreated)
-			m = utils.JSONStatus("Success")
 		}
+		m, _ := json.Marshal(struct {
+			Message string `json:"message"`
+			ID      string `json:"id"`
+		}{
+			Message: "Success",
+			ID:      fmt.Sprintf("%x", id),
+		})
 		io.WriteString(w, string(m))
 
 	default:
@@ -100,6 +169,42 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// Transaction serves GET /transactions/{id} and GET /transactions/{id}/proof.
+func (bcs *BlockchainServer) Transaction(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		path := strings.TrimPrefix(r.URL.Path, "/transactions/")
+		isProof := strings.HasSuffix(path, "/proof")
+		id, err := block.ParseTransactionID(strings.TrimSuffix(path, "/proof"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		if isProof {
+			proof, err := bcs.GetBlockChain().TransactionProof(id)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, string(utils.JSONError(err)))
+				return
+			}
+			m, _ := json.Marshal(proof)
+			io.WriteString(w, string(m))
+			return
+		}
+		ts := bcs.GetBlockChain().TransactionStatus(id)
+		if ts.Status == block.TRANSACTION_UNKNOWN {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		m, _ := json.Marshal(ts)
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Mine(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -135,14 +240,31 @@ func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// MiningStatus serves GET /mine/status with the hashrate of the miner.
+func (bcs *BlockchainServer) MiningStatus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBlockChain().MiningStatus())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Amount(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		blockchainAddress := r.URL.Query().Get("blockchain_address")
-		amount := bcs.GetBlockChain().CalculateTotal(blockchainAddress)
-		ar := &block.AmountResponse{amount}
-		m, _ := ar.MarshalJSON()
 		w.Header().Add("Content-Type", "application/json")
+		if err := bcs.GetBlockChain().CheckAddress(blockchainAddress); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		ar := &block.AmountResponse{Amount: bcs.GetBlockChain().CalculateTotal(blockchainAddress)}
+		m, _ := ar.MarshalJSON()
 		io.WriteString(w, string(m[:]))
 
 	default:
@@ -151,12 +273,368 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// AddressTransactions serves GET /address/{address}/transactions?cursor=&limit=.
+func (bcs *BlockchainServer) AddressTransactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		path := strings.TrimPrefix(r.URL.Path, "/address/")
+		blockchainAddress := strings.TrimSuffix(path, "/transactions")
+		if blockchainAddress == path || blockchainAddress == "" || strings.Contains(blockchainAddress, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JSONStatus("Not Found")))
+			return
+		}
+		if err := bcs.GetBlockChain().CheckAddress(blockchainAddress); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		limit := 0
+		if s := r.URL.Query().Get("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil || limit <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JSONError(fmt.Errorf("invalid limit %q", s))))
+				return
+			}
+		}
+		history, err := bcs.GetBlockChain().AddressTransactions(blockchainAddress, r.URL.Query().Get("cursor"), limit)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		m, _ := json.Marshal(history)
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Nonce(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blockchainAddress := r.URL.Query().Get("blockchain_address")
+		w.Header().Add("Content-Type", "application/json")
+		if err := bcs.GetBlockChain().CheckAddress(blockchainAddress); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		nonce := bcs.GetBlockChain().NextNonce(blockchainAddress)
+		m, _ := json.Marshal(&block.NonceResponse{Nonce: nonce})
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method Request")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Difficulty(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBlockChain().Difficulty())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// UnspentOutputs serves GET /utxos?blockchain_address=, answering 404 when
+// the chain keeps the account ledger.
+func (bcs *BlockchainServer) UnspentOutputs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		blockchainAddress := r.URL.Query().Get("blockchain_address")
+		if err := bcs.GetBlockChain().CheckAddress(blockchainAddress); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		unspent, err := bcs.GetBlockChain().UnspentOutputs(blockchainAddress)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		m, _ := json.Marshal(struct {
+			UnspentOutputs []*block.UnspentOutput `json:"unspent_outputs"`
+		}{
+			UnspentOutputs: unspent,
+		})
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Reorgs serves GET /reorgs.
+func (bcs *BlockchainServer) Reorgs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(struct {
+			Reorgs []*block.ReorgEvent `json:"reorgs"`
+		}{
+			Reorgs: bcs.GetBlockChain().Reorgs(),
+		})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Supply serves GET /supply.
+func (bcs *BlockchainServer) Supply(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBlockChain().Supply())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Params serves GET /params, the chain params the node runs with.
+func (bcs *BlockchainServer) Params(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBlockChain().Params())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// EstimateFee serves GET /fees/estimate.
+func (bcs *BlockchainServer) EstimateFee(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		m, _ := json.Marshal(bcs.GetBlockChain().EstimateFee())
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		bc := bcs.GetBlockChain()
+		replaced := bc.ResolveConflicts()
+		w.Header().Add("Content-Type", "application/json")
+		if replaced {
+			io.WriteString(w, string(utils.JSONStatus("Replaced")))
+		} else {
+			io.WriteString(w, string(utils.JSONStatus("Not Replaced")))
+		}
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) ValidateChain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bc := bcs.GetBlockChain()
+		err := bc.Validate()
+		res := struct {
+			Valid  bool   `json:"valid"`
+			Height *int   `json:"height,omitempty"`
+			Reason string `json:"reason,omitempty"`
+		}{Valid: err == nil}
+		if ce, ok := err.(*block.ChainError); ok {
+			res.Height = &ce.Height
+			res.Reason = ce.Reason
+		}
+		m, _ := json.Marshal(res)
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Reindex serves POST /chain/reindex, rebuilding the balance, transaction
+// and UTXO indexes from the stored blocks.
+func (bcs *BlockchainServer) Reindex(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		w.Header().Add("Content-Type", "application/json")
+		res, err := bcs.GetBlockChain().Reindex()
+		if err != nil {
+			log.Printf("ERROR: Reindex %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		m, _ := json.Marshal(res)
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Blocks serves GET /blocks?from=&limit= and takes announced blocks on PUT
+// /blocks.
+func (bcs *BlockchainServer) Blocks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		var from, limit int
+		for key, v := range map[string]*int{"from": &from, "limit": &limit} {
+			s := r.URL.Query().Get(key)
+			if s == "" {
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JSONError(fmt.Errorf("invalid %s %q", key, s))))
+				return
+			}
+			*v = n
+		}
+		m, _ := json.Marshal(bcs.GetBlockChain().Blocks(from, limit))
+		io.WriteString(w, string(m))
+	case http.MethodPut:
+		decoder := json.NewDecoder(r.Body)
+		var b block.Block
+		err := decoder.Decode(&b)
+		w.Header().Add("Content-Type", "application/json")
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
+		}
+		bc := bcs.GetBlockChain()
+		if err := bc.CheckChainID(b.ChainID()); err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		if bc.ReceiveBlock(&b, senderNode(r)) {
+			io.WriteString(w, string(utils.JSONStatus("Success")))
+		} else {
+			io.WriteString(w, string(utils.JSONStatus("Not Appended")))
+		}
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// senderNode is the host:port of the node that sent r, or empty when it did
+// not name its port.
+func senderNode(r *http.Request) string {
+	port, err := strconv.ParseUint(r.Header.Get(block.NODE_PORT_HEADER), 10, 16)
+	if err != nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(port, 10))
+}
+
+// Block serves GET /blocks/{height}, GET /blocks/hash/{hash} and GET
+// /blocks/latest.
+func (bcs *BlockchainServer) Block(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		bc := bcs.GetBlockChain()
+		path := strings.TrimPrefix(r.URL.Path, "/blocks/")
+		var b *block.BlockResponse
+		var err error
+		switch {
+		case path == "latest":
+			b = bc.LatestBlock()
+		case strings.HasPrefix(path, "hash/"):
+			var hash [32]byte
+			if hash, err = block.ParseBlockHash(strings.TrimPrefix(path, "hash/")); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JSONError(err)))
+				return
+			}
+			b, err = bc.BlockByHash(hash)
+		default:
+			height, perr := strconv.Atoi(path)
+			if perr != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JSONError(fmt.Errorf("invalid height %q", path))))
+				return
+			}
+			b, err = bc.BlockByHeight(height)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JSONError(err)))
+			return
+		}
+		m, _ := json.Marshal(b)
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Run() {
 	bcs.GetBlockChain().Run()
 	http.HandleFunc("/", bcs.GetChain)
 	http.HandleFunc("/transactions", bcs.Transactions)
+	http.HandleFunc("/transactions/", bcs.Transaction)
 	http.HandleFunc("/mine", bcs.Mine)
 	http.HandleFunc("/mine/start", bcs.StartMine)
 	http.HandleFunc("/amount", bcs.Amount)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), nil))
+	http.HandleFunc("/nonce", bcs.Nonce)
+	http.HandleFunc("/address/", bcs.AddressTransactions)
+	http.HandleFunc("/consensus", bcs.Consensus)
+	http.HandleFunc("/reorgs", bcs.Reorgs)
+	http.HandleFunc("/chain/validate", bcs.ValidateChain)
+	http.HandleFunc("/chain/reindex", bcs.Reindex)
+	http.HandleFunc("/blocks", bcs.Blocks)
+	http.HandleFunc("/blocks/", bcs.Block)
+	http.HandleFunc("/difficulty", bcs.Difficulty)
+	http.HandleFunc("/mine/status", bcs.MiningStatus)
+	http.HandleFunc("/fees/estimate", bcs.EstimateFee)
+	http.HandleFunc("/supply", bcs.Supply)
+	http.HandleFunc("/params", bcs.Params)
+	http.HandleFunc("/utxos", bcs.UnspentOutputs)
+
+	srv := &http.Server{Addr: "0.0.0.0:" + strconv.Itoa(int(bcs.Port()))}
+	go func() {
+		// stop the miner and flush the store on Ctrl-C instead of dying mid-write
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		log.Println("action=shutdown")
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	if err := bcs.GetBlockChain().Close(); err != nil {
+		log.Printf("ERROR: Close blockchain %v", err)
+	}
 }
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"log"
+
+	"github.com/bc/block"
 )
 
 func init() {
@@ -10,8 +12,29 @@ func init() {
 }
 
 func main() {
-	port := flag.Uint("port", 5000, "TCP Port Number for Blockchain Server")
+	port := flag.Uint("port", 0, "TCP Port Number for Blockchain Server, 0 for the first port of the network")
+	dataDir := flag.String("datadir", "chaindata", "Directory for the chain store, empty keeps the chain in memory")
+	network := flag.String("network", block.NETWORK_MAINNET, "Network preset, mainnet, testnet or regtest")
+	paramsFile := flag.String("params", "", "JSON file of chain params, overrides -network")
+	ledger := flag.String("ledger", "", "Ledger, account or utxo, overrides the chain params; the genesis block commits to it")
 	flag.Parse()
-	app := NewBlockchainServer(uint16(*port))
+
+	var params *block.ChainParams
+	var err error
+	if *paramsFile != "" {
+		params, err = block.LoadChainParams(*paramsFile)
+	} else {
+		params, err = block.ParamsForNetwork(*network)
+	}
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+	if *ledger != "" {
+		params.Ledger = *ledger
+	}
+	if *port == 0 {
+		*port = uint(params.PortRangeStart)
+	}
+	app := NewBlockchainServer(uint16(*port), *dataDir, params)
 	app.Run()
 }
@@ -5,6 +5,7 @@ import (
 	"log"
 
 	"github.com/bc/block"
+	"github.com/bc/utils"
 	"github.com/bc/wallet"
 )
 
@@ -14,33 +15,44 @@ func init() {
 
 func main() {
 	// Creating wallet
-	minerWallet := wallet.NewWallet()
+	params := block.RegtestParams()
+	minerWallet := wallet.NewWallet(params.AddressVersion)
 	fmt.Println("minerWallet Blockchain Address\n", minerWallet.BlockchainAddress())
 
-	personA := wallet.NewWallet()
-	fmt.Println("personA Blockchain Address\n", personA.BlockchainAddress())
-
-	personB := wallet.NewWallet()
+	personB := wallet.NewWallet(params.AddressVersion)
 	fmt.Println("personB Blockchain Address\n", personB.BlockchainAddress())
 
-	var value float32 = 2.0
+	value := 2 * utils.COIN
+
+	blockChain, err := block.NewBlockChainWithParams(minerWallet.BlockchainAddress(), 0, block.NewMemoryStore(), params)
+	if err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
+
+	// ***************Miner transactions********//
+	// Empty blocks earn the miner the coins it sends below; a reward can only
+	// be spent CoinbaseMaturity blocks after it was mined
+	for i := 0; i < params.CoinbaseMaturity+2; i++ {
+		blockChain.Mining()
+	}
 
 	// *************Creating Transaction********************//
 
 	//Creating transaction on the Wallet side
-	t := wallet.NewTransaction(personA.PrivateKey(), personA.PublicKey(), personA.BlockchainAddress(), personB.BlockchainAddress(), value)
+	t := wallet.NewTransaction(params.NetworkID, minerWallet.PrivateKey(), minerWallet.PublicKey(), minerWallet.BlockchainAddress(), personB.BlockchainAddress(), value, 0, 0)
 	fmt.Printf("Signature: %s\n", t.GenerateSignature())
 
 	//Creating transaction on the blockchain node side
-	blockChain := block.NewBlockChain(minerWallet.BlockchainAddress())
-	isAdded := blockChain.AddTransaction(personA.BlockchainAddress(), personB.BlockchainAddress(), value, personA.PublicKey(), t.GenerateSignature())
-	log.Println("Is it Added? ", isAdded)
+	err = blockChain.AddTransaction(params.NetworkID, minerWallet.BlockchainAddress(), personB.BlockchainAddress(), value, 0, 0, minerWallet.PublicKey(), t.GenerateSignature())
+	log.Println("Is it Added? ", err == nil)
 
-	// ***************Miner transactions********//
 	blockChain.Mining()
 	blockChain.Print()
-	fmt.Printf("Wallet of PersonA %1f\n", blockChain.CalculateTotal(personA.BlockchainAddress()))
-	fmt.Printf("Wallet of PersonB %1f\n", blockChain.CalculateTotal(personB.BlockchainAddress()))
-	fmt.Printf("Wallet of miner %1f\n", blockChain.CalculateTotal(minerWallet.BlockchainAddress()))
+	for name, address := range map[string]string{
+		"PersonB": personB.BlockchainAddress(),
+		"miner":   minerWallet.BlockchainAddress(),
+	} {
+		fmt.Printf("Wallet of %s %s\n", name, blockChain.CalculateTotal(address))
+	}
 
 }
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+var ErrInvalidAddress = errors.New("invalid blockchain address")
+
+// BlockchainAddress derives the address owned by publicKey on the network
+// whose addresses start with version.
+func BlockchainAddress(publicKey *ecdsa.PublicKey, version byte) string {
+	// 2. Perform SHA-256 Hashing on PublicKey (32bytes)
+	h2 := sha256.New()
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
+	digest2 := h2.Sum(nil)
+	// 3. Perform RIPEMD-160 hashing on result of SHA256 (20bytes)
+	h3 := ripemd160.New()
+	h3.Write(digest2)
+	digest3 := h3.Sum(nil)
+	// 4. Add version Byte infront of RIPEMD-160, one per network
+	vd4 := make([]byte, 21)
+	vd4[0] = version
+	copy(vd4[1:], digest3[:])
+	// 5-7. Take the first four bytes of a double SHA-256 for checksum
+	chsum := addressChecksum(vd4)
+	// 8. Add four bytes at the end of the result of extended RIPE-160 from step 4 (25bytes)
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], chsum[:])
+	// 9. Convert the result into byte string into BASE58
+	return base58.Encode(dc8)
+}
+
+// AddressVersion checks the checksum of address and returns its version
+// byte, failing with ErrInvalidAddress.
+func AddressVersion(address string) (byte, error) {
+	b := base58.Decode(address)
+	if len(b) != 25 || !bytes.Equal(addressChecksum(b[:21]), b[21:]) {
+		return 0, ErrInvalidAddress
+	}
+	return b[0], nil
+}
+
+func addressChecksum(versioned []byte) []byte {
+	digest5 := sha256.Sum256(versioned)
+	digest6 := sha256.Sum256(digest5[:])
+	return digest6[:4]
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a number of base units; one coin is COIN base units. JSON wire
+// formats carry the base units as an integer.
+type Amount int64
+
+const (
+	COIN_DECIMALS        = 8
+	COIN          Amount = 100000000
+	MAX_AMOUNT    Amount = math.MaxInt64
+)
+
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// ParseAmount reads a non-negative decimal coin string such as "1.25" into
+// base units, rejecting more than COIN_DECIMALS decimals.
+func ParseAmount(s string) (Amount, error) {
+	whole, frac, hasFrac := strings.Cut(strings.TrimSpace(s), ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if hasFrac && frac == "" || len(frac) > COIN_DECIMALS {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+	var w, f int64
+	var err error
+	if whole != "" {
+		if w, err = strconv.ParseInt(whole, 10, 64); err != nil {
+			return 0, ErrAmountOverflow
+		}
+	}
+	if frac != "" {
+		f, _ = strconv.ParseInt(frac+strings.Repeat("0", COIN_DECIMALS-len(frac)), 10, 64)
+	}
+	a, err := Amount(w).Mul(COIN)
+	if err != nil {
+		return 0, err
+	}
+	return a.Add(Amount(f))
+}
+
+// String formats a as a decimal coin string without trailing zeros.
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-(a + 1)) + 1
+	}
+	whole, frac := u/uint64(COIN), u%uint64(COIN)
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fs := strings.TrimRight(fmt.Sprintf("%0*d", COIN_DECIMALS, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fs)
+}
+
+// Add returns a+b or ErrAmountOverflow.
+func (a Amount) Add(b Amount) (Amount, error) {
+	c := a + b
+	if (b > 0 && c < a) || (b < 0 && c > a) {
+		return 0, ErrAmountOverflow
+	}
+	return c, nil
+}
+
+// Sub returns a-b or ErrAmountOverflow.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	c := a - b
+	if (b > 0 && c > a) || (b < 0 && c < a) {
+		return 0, ErrAmountOverflow
+	}
+	return c, nil
+}
+
+// Mul returns a*n or ErrAmountOverflow.
+func (a Amount) Mul(n Amount) (Amount, error) {
+	if a == 0 || n == 0 {
+		return 0, nil
+	}
+	c := a * n
+	if c/n != a || (a == -1 && n == math.MinInt64) || (n == -1 && a == math.MinInt64) {
+		return 0, ErrAmountOverflow
+	}
+	return c, nil
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// errInvalid marks the inputs ParseAmount must refuse as malformed.
+var errInvalid = errors.New("invalid")
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Amount
+		err  error // ErrAmountOverflow, errInvalid or nil
+	}{
+		{"1", COIN, nil},
+		{"1.25", 125000000, nil},
+		{"1.10", 110000000, nil},
+		{"0.00000001", 1, nil},
+		{".5", 50000000, nil},
+		{" 2 ", 2 * COIN, nil},
+		{"0", 0, nil},
+		{"92233720368.54775807", MAX_AMOUNT, nil},
+		// more decimals than a base unit are refused, never rounded
+		{"0.000000015", 0, errInvalid},
+		{"1.123456789", 0, errInvalid},
+		{"", 0, errInvalid},
+		{" ", 0, errInvalid},
+		{".", 0, errInvalid},
+		{"5.", 0, errInvalid},
+		{"-1", 0, errInvalid},
+		{"+1", 0, errInvalid},
+		{"1e5", 0, errInvalid},
+		{"1.2.3", 0, errInvalid},
+		{"92233720368.54775808", 0, ErrAmountOverflow},
+		{"92233720369", 0, ErrAmountOverflow},
+		{"99999999999999999999", 0, ErrAmountOverflow},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.s)
+		switch {
+		case tt.err == nil && err != nil:
+			t.Errorf("ParseAmount(%q) failed: %v", tt.s, err)
+		case tt.err == ErrAmountOverflow && !errors.Is(err, ErrAmountOverflow):
+			t.Errorf("ParseAmount(%q) error %v, want %v", tt.s, err, ErrAmountOverflow)
+		case tt.err == errInvalid && (err == nil || errors.Is(err, ErrAmountOverflow)):
+			t.Errorf("ParseAmount(%q) error %v, want an invalid amount", tt.s, err)
+		case got != tt.want:
+			t.Errorf("ParseAmount(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{0, "0"},
+		{1, "0.00000001"},
+		{COIN, "1"},
+		{125000000, "1.25"},
+		{-150000000, "-1.5"},
+		{-1, "-0.00000001"},
+		{MAX_AMOUNT, "92233720368.54775807"},
+		{math.MinInt64, "-92233720368.54775808"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.a), got, tt.want)
+		}
+		if tt.a < 0 {
+			continue
+		}
+		if back, err := ParseAmount(tt.want); err != nil || back != tt.a {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.want, back, err, tt.a)
+		}
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	const max, min = MAX_AMOUNT, Amount(math.MinInt64)
+	tests := []struct {
+		name     string
+		op       func(a, b Amount) (Amount, error)
+		a, b     Amount
+		want     Amount
+		overflow bool
+	}{
+		{"add", Amount.Add, COIN, 2 * COIN, 3 * COIN, false},
+		{"add", Amount.Add, max, min, -1, false},
+		{"add", Amount.Add, max, 1, 0, true},
+		{"add", Amount.Add, min, -1, 0, true},
+		{"add", Amount.Add, max - 1, 1, max, false},
+		{"sub", Amount.Sub, COIN, 2 * COIN, -COIN, false},
+		{"sub", Amount.Sub, -1, max, min, false},
+		{"sub", Amount.Sub, min, 1, 0, true},
+		{"sub", Amount.Sub, 0, min, 0, true},
+		{"sub", Amount.Sub, max, -1, 0, true},
+		{"mul", Amount.Mul, COIN, 92233720368, 9223372036800000000, false},
+		{"mul", Amount.Mul, COIN, 92233720369, 0, true},
+		{"mul", Amount.Mul, max, 2, 0, true},
+		{"mul", Amount.Mul, min, 1, min, false},
+		{"mul", Amount.Mul, 0, min, 0, false},
+		{"mul", Amount.Mul, min, -1, 0, true},
+		{"mul", Amount.Mul, -1, min, 0, true},
+		{"mul", Amount.Mul, -3, 4, -12, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.op(tt.a, tt.b)
+		if tt.overflow {
+			if !errors.Is(err, ErrAmountOverflow) {
+				t.Errorf("%s(%d, %d) = %d, %v, want overflow", tt.name, tt.a, tt.b, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s(%d, %d) = %d, %v, want %d", tt.name, tt.a, tt.b, got, err, tt.want)
+		}
+	}
+}
@@ -19,7 +19,7 @@ func (s *Signature) String() string {
 
 func SignatureFromString(s string) *Signature {
 	x, y := String2BigIntTuple(s)
-	return &Signature{&x, &y}
+	return &Signature{R: &x, S: &y}
 }
 
 func String2BigIntTuple(s string) (big.Int, big.Int) {
@@ -37,11 +37,11 @@ func String2BigIntTuple(s string) (big.Int, big.Int) {
 
 func PublicKeyFromString(s string) *ecdsa.PublicKey {
 	x, y := String2BigIntTuple(s)
-	return &ecdsa.PublicKey{elliptic.P256(), &x, &y}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: &x, Y: &y}
 }
 func PrivateKeyFromString(s string, publickey *ecdsa.PublicKey) *ecdsa.PrivateKey {
 	b, _ := hex.DecodeString(s[:])
 	var bi big.Int
 	_ = bi.SetBytes(b)
-	return &ecdsa.PrivateKey{*publickey, &bi}
+	return &ecdsa.PrivateKey{PublicKey: *publickey, D: &bi}
 }
@@ -10,3 +10,15 @@ func JSONStatus(message string) []byte {
 	})
 	return m
 }
+
+// JSONError reports a failed request along with the reason.
+func JSONError(err error) []byte {
+	m, _ := json.Marshal(struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}{
+		Message: "Failed",
+		Error:   err.Error(),
+	})
+	return m
+}
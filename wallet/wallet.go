@@ -4,13 +4,16 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
 
+	"github.com/bc/block"
 	"github.com/bc/utils"
-	"github.com/btcsuite/btcutil/base58"
-	"golang.org/x/crypto/ripemd160"
 )
 
 // ***************Wallet*********//
@@ -21,11 +24,14 @@ type Wallet struct {
 }
 
 type Transaction struct {
+	chainID                   uint32
 	senderPrivateKey          *ecdsa.PrivateKey
 	senderPublicKey           *ecdsa.PublicKey
 	senderBlockchainAddress   string
 	receiverBlockchainAddress string
-	value                     float32
+	value                     utils.Amount
+	fee                       utils.Amount
+	nonce                     uint64
 }
 
 type TransactionRequest struct {
@@ -34,47 +40,50 @@ type TransactionRequest struct {
 	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee,omitempty"`
 }
 
-func NewWallet() *Wallet {
+// NewWallet creates a key pair and its address on the network whose
+// addresses start with addressVersion.
+func NewWallet(addressVersion byte) *Wallet {
 	// 1. Create ECDSA PrivateKey (32bytes) and PublicKey (64bytes)
 	w := new(Wallet)
 	privatekey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	w.privateKey = privatekey
 	w.publicKey = &w.privateKey.PublicKey
-	// 2. Perform SHA-256 Hashing on PublicKey (32bytes)
-	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
-	digest2 := h2.Sum(nil)
-	// 3. Perform RIPEMD-160 hashing on result of SHA256 (20bytes)
-	h3 := ripemd160.New()
-	h3.Write(digest2)
-	digest3 := h3.Sum(nil)
-	// 4. Add version Byte infront of RIPEMD-160 - 0x00 on main network
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3[:])
-	// 5. Perform SHA-256 hashing on extended RIPEMD-160 result
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-	// 6. Perform SHA-256 hashing on result from 5th step
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-	// 7. Take first four bytes from SHA-256 hash for checksum
-	chsum := digest6[:4]
-	// 8. Add four bytes at the end of the result of extended RIPE-160 from step 4 (25bytes)
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[:21], chsum[:])
-	// 9. Convert the result into byte string into BASE58
-	address := base58.Encode(dc8)
-	w.blockchainAddress = address
+	// 2-9. Derive the address from the PublicKey
+	w.blockchainAddress = utils.BlockchainAddress(w.publicKey, addressVersion)
 	return w
 }
 
+// LoadWallet reads the wallet whose private key is kept in hex at path,
+// creating one and saving its key there when the file does not exist yet.
+func LoadWallet(path string, addressVersion byte) (*Wallet, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		w := NewWallet(addressVersion)
+		if err := os.WriteFile(path, []byte(w.PrivateKeyStr()+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	d, ok := new(big.Int).SetString(strings.TrimSpace(string(data)), 16)
+	if !ok || d.Sign() <= 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("invalid private key in %s", path)
+	}
+	w := new(Wallet)
+	w.privateKey = &ecdsa.PrivateKey{D: d}
+	w.privateKey.PublicKey.Curve = curve
+	w.privateKey.PublicKey.X, w.privateKey.PublicKey.Y = curve.ScalarBaseMult(d.Bytes())
+	w.publicKey = &w.privateKey.PublicKey
+	w.blockchainAddress = utils.BlockchainAddress(w.publicKey, addressVersion)
+	return w, nil
+}
+
 func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
 	return w.privateKey
 }
@@ -108,26 +117,35 @@ func (w *Wallet) MarshalJSON() ([]byte, error) {
 }
 
 // ********************Transaction in Wallet**********************//
-func NewTransaction(privatekey *ecdsa.PrivateKey, publickey *ecdsa.PublicKey, sender string, receiver string, value float32) *Transaction {
-	return &Transaction{privatekey, publickey, sender, receiver, value}
+// NewTransaction creates a transaction to sign for the chain chainID paying
+// fee to the miner; nonce must be the next nonce of sender on the chain.
+func NewTransaction(chainID uint32, privatekey *ecdsa.PrivateKey, publickey *ecdsa.PublicKey, sender string, receiver string, value, fee utils.Amount, nonce uint64) *Transaction {
+	return &Transaction{chainID, privatekey, publickey, sender, receiver, value, fee, nonce}
 }
 
+// GenerateSignature signs the canonical encoding of t defined by the block
+// package, so nodes verify exactly the bytes signed here.
 func (t *Transaction) GenerateSignature() *utils.Signature {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
+	h := block.TransactionSigningHash(t.chainID, t.senderBlockchainAddress, t.receiverBlockchainAddress, t.value, t.fee, t.nonce)
 	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
-	return &utils.Signature{r, s}
+	return &utils.Signature{R: r, S: s}
 }
 
 func (t *Transaction) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Sender   string  `json:"sender_blockchain_address"`
-		Receiver string  `json:"receiver_blockchain_address"`
-		Value    float32 `json:"value"`
+		ChainID  uint32       `json:"chain_id"`
+		Sender   string       `json:"sender_blockchain_address"`
+		Receiver string       `json:"receiver_blockchain_address"`
+		Value    utils.Amount `json:"value"`
+		Fee      utils.Amount `json:"fee"`
+		Nonce    uint64       `json:"nonce"`
 	}{
+		ChainID:  t.chainID,
 		Sender:   t.senderBlockchainAddress,
 		Receiver: t.receiverBlockchainAddress,
 		Value:    t.value,
+		Fee:      t.fee,
+		Nonce:    t.nonce,
 	})
 }
 
@@ -138,3 +156,67 @@ func (tr TransactionRequest) Validate() bool {
 	}
 	return true
 }
+
+// ********************UTXO Transaction in Wallet**********************//
+
+var ErrInsufficientFunds = errors.New("insufficient spendable outputs")
+
+// SelectCoins picks spendable outputs worth at least target. The smallest
+// single output covering target wins, so no change is needed if one matches
+// exactly; otherwise the largest outputs are taken until target is reached,
+// keeping the number of inputs low.
+func SelectCoins(unspent []*block.UnspentOutput, target utils.Amount) ([]*block.UnspentOutput, utils.Amount, error) {
+	spendable := make([]*block.UnspentOutput, 0, len(unspent))
+	for _, u := range unspent {
+		if u.Spendable {
+			spendable = append(spendable, u)
+		}
+	}
+	sort.Slice(spendable, func(i, j int) bool { return spendable[i].Value > spendable[j].Value })
+	for i := len(spendable) - 1; i >= 0; i-- {
+		if spendable[i].Value >= target {
+			return spendable[i : i+1], spendable[i].Value, nil
+		}
+	}
+	var total utils.Amount
+	for i, u := range spendable {
+		total += u.Value
+		if total >= target {
+			return spendable[:i+1], total, nil
+		}
+	}
+	return nil, 0, ErrInsufficientFunds
+}
+
+// NewUTXOTransaction selects outputs of the sender owning privatekey to pay
+// value to receiver plus fee, sends the change to changeAddress and signs
+// every input for the chain chainID.
+func NewUTXOTransaction(chainID uint32, privatekey *ecdsa.PrivateKey, publickey *ecdsa.PublicKey, unspent []*block.UnspentOutput, receiver string, value, fee utils.Amount, changeAddress string) (*block.Transaction, error) {
+	target, err := value.Add(fee)
+	if err != nil {
+		return nil, err
+	}
+	selected, total, err := SelectCoins(unspent, target)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]*block.TxInput, len(selected))
+	for i, u := range selected {
+		inputs[i] = &block.TxInput{PreviousOutput: u.OutPoint}
+	}
+	outputs := []*block.TxOutput{{Address: receiver, Value: value}}
+	if change := total - target; change > 0 {
+		outputs = append(outputs, &block.TxOutput{Address: changeAddress, Value: change})
+	}
+	t := block.NewUTXOTransaction(chainID, inputs, outputs, fee)
+	h := t.SigningHash()
+	for _, in := range inputs {
+		r, s, err := ecdsa.Sign(rand.Reader, privatekey, h[:])
+		if err != nil {
+			return nil, err
+		}
+		in.PublicKey = publickey
+		in.Signature = &utils.Signature{R: r, S: s}
+	}
+	return t, nil
+}
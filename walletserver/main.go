@@ -12,6 +12,7 @@ func init() {
 func main() {
 	port := flag.Uint("port", 8080, "TCP port number for wallet Server")
 	gateway := flag.String("gateway", "http://127.0.0.1:5000", "Blockchain Gateway")
+	flag.Parse()
 
 	app := NewWalletServer(uint16(*port), *gateway)
 	app.Run()
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/bc/block"
 	"github.com/bc/utils"
@@ -11,8 +12,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
+	"sync"
 )
 
 const tempURL = "walletserver/templates/"
@@ -20,6 +23,8 @@ const tempURL = "walletserver/templates/"
 type WalletServer struct {
 	port    uint16
 	gateway string
+	mux     sync.Mutex
+	params  *block.ChainParams
 }
 
 func NewWalletServer(port uint16, gateway string) *WalletServer {
@@ -47,7 +52,13 @@ func (ws *WalletServer) Wallet(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodPost:
 		w.Header().Add("Content-Type", "application/json")
-		myWallet := wallet.NewWallet()
+		params, err := ws.chainParams()
+		if err != nil {
+			log.Printf("ERROR: Fetch chain params %v", err)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
+		}
+		myWallet := wallet.NewWallet(params.AddressVersion)
 		m, _ := myWallet.MarshalJSON()
 		io.WriteString(w, string(m[:]))
 	default:
@@ -75,34 +86,106 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, r *http.Request
 
 		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
 		privateKey := utils.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		value, err := strconv.ParseFloat(*t.Value, 32)
+		value, err := utils.ParseAmount(*t.Value)
 		if err != nil {
 			log.Printf("ERROR: Parse error -  %v", err)
 			io.WriteString(w, string(utils.JSONStatus("failed")))
 			return
 		}
-		value32 := float32(value)
 		w.Header().Add("Content-Type", "application/json")
 
-		transaction := wallet.NewTransaction(privateKey, publicKey, *t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, value32)
-		signature := transaction.GenerateSignature()
-		signatureStr := signature.String()
+		// never sign for another network than the gateway's
+		params, err := ws.chainParams()
+		if err != nil {
+			log.Printf("ERROR: Fetch chain params %v", err)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
+		}
+		for _, address := range []string{*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress} {
+			if err := params.CheckAddress(address); err != nil {
+				log.Printf("ERROR: %v", err)
+				io.WriteString(w, string(utils.JSONError(err)))
+				return
+			}
+		}
+
+		// without a fee from the client pay what the gateway suggests
+		var fee utils.Amount
+		if t.Fee != nil && *t.Fee != "" {
+			fee, err = utils.ParseAmount(*t.Fee)
+		} else {
+			fee, err = ws.estimateFee()
+		}
+		if err != nil {
+			log.Printf("ERROR: Fee %v", err)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
+		}
+
+		var bt *block.TransactionRequest
+		unspent, err := ws.unspentOutputs(*t.SenderBlockchainAddress)
+		switch {
+		case err == nil:
+			// the gateway keeps a utxo ledger; change goes back to the sender
+			transaction, err := wallet.NewUTXOTransaction(params.NetworkID, privateKey, publicKey, unspent, *t.RecipientBlockchainAddress, value, fee, *t.SenderBlockchainAddress)
+			if err != nil {
+				log.Printf("ERROR: Build transaction %v", err)
+				io.WriteString(w, string(utils.JSONError(err)))
+				return
+			}
+			bt = &block.TransactionRequest{
+				ChainID: &params.NetworkID,
+				Fee:     &fee,
+				Inputs:  transaction.Inputs(),
+				Outputs: transaction.Outputs(),
+			}
+		case errors.Is(err, errAccountLedger):
+			nonce, err := ws.nextNonce(*t.SenderBlockchainAddress)
+			if err != nil {
+				log.Printf("ERROR: Fetch nonce %v", err)
+				io.WriteString(w, string(utils.JSONStatus("Failed")))
+				return
+			}
+			transaction := wallet.NewTransaction(params.NetworkID, privateKey, publicKey, *t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, value, fee, nonce)
+			signature := transaction.GenerateSignature()
+			signatureStr := signature.String()
 
-		bt := &block.TransactionRequest{
-			t.SenderPublicKey,
-			t.SenderBlockchainAddress,
-			t.RecipientBlockchainAddress,
-			&value32,
-			&signatureStr,
+			bt = &block.TransactionRequest{
+				ChainID:                    &params.NetworkID,
+				SenderPublicKey:            t.SenderPublicKey,
+				SenderBlockchainAddress:    t.SenderBlockchainAddress,
+				RecipientBlockchainAddress: t.RecipientBlockchainAddress,
+				Value:                      &value,
+				Fee:                        &fee,
+				Nonce:                      &nonce,
+				Signature:                  &signatureStr,
+			}
+		default:
+			log.Printf("ERROR: Fetch unspent outputs %v", err)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
 		}
 		m, _ := json.Marshal(bt)
 		buf := bytes.NewBuffer(m)
 		resp, err := http.Post(ws.Gateway()+"/transactions", "application/json", buf)
 		if err != nil {
 			log.Printf("ERROR: Backserver didn't respond %v", err)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
 		}
+		defer resp.Body.Close()
 		if resp.StatusCode == 201 {
-			io.WriteString(w, string(utils.JSONStatus("Success")))
+			// hand the transaction id on so the client can follow it
+			m, _ := io.ReadAll(resp.Body)
+			io.WriteString(w, string(m))
+			return
+		}
+		// pass the reason given by the blockchain server on to the client
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Error != "" {
+			io.WriteString(w, string(utils.JSONError(errors.New(failure.Error))))
 			return
 		}
 		io.WriteString(w, string(utils.JSONStatus("Failed")))
@@ -113,6 +196,98 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// nextNonce asks the gateway for the nonce the next transaction of
+// blockchainAddress must be signed with.
+func (ws *WalletServer) nextNonce(blockchainAddress string) (uint64, error) {
+	bcsReq, _ := http.NewRequest("GET", ws.Gateway()+"/nonce", nil)
+	q := bcsReq.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	bcsReq.URL.RawQuery = q.Encode()
+	bcsResp, err := http.DefaultClient.Do(bcsReq)
+	if err != nil {
+		return 0, err
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+	var nr block.NonceResponse
+	if err := json.NewDecoder(bcsResp.Body).Decode(&nr); err != nil {
+		return 0, err
+	}
+	return nr.Nonce, nil
+}
+
+var errAccountLedger = errors.New("gateway keeps an account ledger")
+
+// unspentOutputs asks the gateway for the unspent outputs of
+// blockchainAddress, failing with errAccountLedger when it keeps no utxo
+// ledger.
+func (ws *WalletServer) unspentOutputs(blockchainAddress string) ([]*block.UnspentOutput, error) {
+	bcsReq, _ := http.NewRequest("GET", ws.Gateway()+"/utxos", nil)
+	q := bcsReq.URL.Query()
+	q.Add("blockchain_address", blockchainAddress)
+	bcsReq.URL.RawQuery = q.Encode()
+	bcsResp, err := http.DefaultClient.Do(bcsReq)
+	if err != nil {
+		return nil, err
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode == http.StatusNotFound {
+		return nil, errAccountLedger
+	}
+	if bcsResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+	var ur struct {
+		UnspentOutputs []*block.UnspentOutput `json:"unspent_outputs"`
+	}
+	if err := json.NewDecoder(bcsResp.Body).Decode(&ur); err != nil {
+		return nil, err
+	}
+	return ur.UnspentOutputs, nil
+}
+
+// chainParams asks the gateway once for the chain params of its network.
+func (ws *WalletServer) chainParams() (*block.ChainParams, error) {
+	ws.mux.Lock()
+	defer ws.mux.Unlock()
+	if ws.params != nil {
+		return ws.params, nil
+	}
+	bcsResp, err := http.Get(ws.Gateway() + "/params")
+	if err != nil {
+		return nil, err
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+	var params block.ChainParams
+	if err := json.NewDecoder(bcsResp.Body).Decode(&params); err != nil {
+		return nil, err
+	}
+	ws.params = &params
+	return ws.params, nil
+}
+
+// estimateFee asks the gateway for the fee of a typical transaction.
+func (ws *WalletServer) estimateFee() (utils.Amount, error) {
+	bcsResp, err := http.Get(ws.Gateway() + "/fees/estimate")
+	if err != nil {
+		return 0, err
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("gateway responded %s", bcsResp.Status)
+	}
+	var fe block.FeeEstimate
+	if err := json.NewDecoder(bcsResp.Body).Decode(&fe); err != nil {
+		return 0, err
+	}
+	return fe.Fee, nil
+}
+
 func (ws *WalletServer) WalletAmount(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -141,11 +316,11 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message string `json:"message"`
+				Amount  string `json:"amount"`
 			}{
 				Message: "Success",
-				Amount:  bar.Amount,
+				Amount:  bar.Amount.String(),
 			})
 			io.WriteString(w, string(m[:]))
 
@@ -159,10 +334,43 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// WalletTransactions serves GET /wallet/transactions?blockchain_address=&cursor=&limit=
+// by relaying the address history of the gateway.
+func (ws *WalletServer) WalletTransactions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		blockchainAddress := r.URL.Query().Get("blockchain_address")
+		endpoint := fmt.Sprintf("%s/address/%s/transactions", ws.Gateway(), url.PathEscape(blockchainAddress))
+		bcsReq, _ := http.NewRequest("GET", endpoint, nil)
+		q := bcsReq.URL.Query()
+		for _, key := range []string{"cursor", "limit"} {
+			if v := r.URL.Query().Get(key); v != "" {
+				q.Add(key, v)
+			}
+		}
+		bcsReq.URL.RawQuery = q.Encode()
+		bcsResp, err := http.DefaultClient.Do(bcsReq)
+		w.Header().Add("Content-Type", "application/json")
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			io.WriteString(w, string(utils.JSONStatus("Failed")))
+			return
+		}
+		defer bcsResp.Body.Close()
+		w.WriteHeader(bcsResp.StatusCode)
+		io.Copy(w, bcsResp.Body)
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (ws *WalletServer) Run() {
 	http.HandleFunc("/", ws.Index)
 	http.HandleFunc("/wallet", ws.Wallet)
 	http.HandleFunc("/wallet/amount", ws.WalletAmount)
+	http.HandleFunc("/wallet/transactions", ws.WalletTransactions)
 	http.HandleFunc("/transaction", ws.CreateTransaction)
 	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), nil))
 }